@@ -0,0 +1,87 @@
+package ncclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ApplyOptions controls the steps ApplyConfig takes.
+type ApplyOptions struct {
+	// Edit holds the edit-config parameters.
+	Edit EditConfigOptions
+	// Validate validates the candidate before committing it.
+	Validate bool
+	// Confirmed makes the commit a confirmed commit, rolled back unless
+	// confirmed with ConfirmCommit within ConfirmTimeout, or the server
+	// default if that is zero.
+	Confirmed      bool
+	ConfirmTimeout time.Duration
+	// LockAttempts and LockBackoff retry taking the lock while another
+	// session holds it, as LockWithRetry does. By default it is tried
+	// once.
+	LockAttempts int
+	LockBackoff  time.Duration
+}
+
+// ApplyError reports which step of ApplyConfig failed.
+type ApplyError struct {
+	// Stage is "lock", "edit-config", "validate", "commit" or "unlock".
+	Stage string
+	Err   error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("apply config: %s failed: %v", e.Stage, e.Err)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyConfig runs the candidate workflow: it locks the candidate, loads
+// config into it with edit-config, optionally validates it, commits it and
+// unlocks the candidate again. If a step after the lock fails the changes
+// are discarded before unlocking. Errors are *ApplyError values naming the
+// failed step, wrapping the rpc-error or other cause. It returns the reply
+// to the commit.
+func (n *Ncclient) ApplyConfig(config string, opts ApplyOptions) (*RPCReply, error) {
+	return n.ApplyConfigContext(context.Background(), config, opts)
+}
+
+// ApplyConfigContext is like ApplyConfig but gives up when ctx is done.
+func (n *Ncclient) ApplyConfigContext(ctx context.Context, config string, opts ApplyOptions) (reply *RPCReply, err error) {
+	if err := n.requireCapability(CAPABILITY_CANDIDATE); err != nil {
+		return nil, err
+	}
+	if _, err := n.LockWithRetryContext(ctx, "candidate", opts.LockAttempts, opts.LockBackoff); err != nil {
+		return nil, &ApplyError{Stage: "lock", Err: err}
+	}
+	defer func() {
+		if err != nil {
+			// a failed step leaves the candidate as it was before
+			n.DiscardChangesContext(ctx)
+		}
+		if _, unlockErr := n.UnlockContext(ctx, "candidate"); unlockErr != nil && err == nil {
+			err = &ApplyError{Stage: "unlock", Err: unlockErr}
+		}
+	}()
+
+	if _, err := n.EditConfigContext(ctx, "candidate", config, opts.Edit); err != nil {
+		return nil, &ApplyError{Stage: "edit-config", Err: err}
+	}
+	if opts.Validate {
+		if _, err := n.ValidateContext(ctx, "candidate"); err != nil {
+			return nil, &ApplyError{Stage: "validate", Err: err}
+		}
+	}
+	if opts.Confirmed {
+		reply, err = n.CommitConfirmedContext(ctx, opts.ConfirmTimeout, "")
+	} else {
+		reply, err = n.CommitContext(ctx)
+	}
+	if err != nil {
+		return reply, &ApplyError{Stage: "commit", Err: err}
+	}
+	return reply, nil
+}
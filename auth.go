@@ -0,0 +1,94 @@
+package ncclient
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"code.google.com/p/go.crypto/ssh/agent"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// authMethods returns the SSH authentication methods to try: those set with
+// WithAuthMethods if any, otherwise, in order, ssh-agent keys, the
+// configured private key, the password, then keyboard-interactive if it
+// was enabled. The returned Closer releases
+// the ssh-agent connection and must be closed once the SSH handshake is
+// done.
+func (n *Ncclient) authMethods() ([]ssh.AuthMethod, io.Closer, error) {
+	var auth []ssh.AuthMethod
+	var closer io.Closer = nopCloser{}
+
+	if n.sshAuth != nil {
+		return n.sshAuth, closer, nil
+	}
+
+	if n.useAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, fmt.Errorf("ssh-agent authentication requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		closer = conn
+	}
+
+	if n.key != "" {
+		signer, err := n.parseKey()
+		if err != nil {
+			closer.Close()
+			return nil, nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	auth = append(auth, ssh.Password(n.password))
+	if n.keyboardInteractive {
+		auth = append(auth, ssh.KeyboardInteractive(n.answerPrompts))
+	}
+	return auth, closer, nil
+}
+
+// answerPrompts answers a keyboard-interactive challenge from the
+// configured credentials: prompts shown with echo, such as a username
+// prompt, get the username and hidden ones get the password.
+func (n *Ncclient) answerPrompts(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i := range questions {
+		if echos[i] {
+			answers[i] = n.username
+		} else {
+			answers[i] = n.password
+		}
+	}
+	return answers, nil
+}
+
+// parseKey parses the configured private key, decrypting it with the
+// configured passphrase if there is one.
+func (n *Ncclient) parseKey() (ssh.Signer, error) {
+	var signer ssh.Signer
+	var err error
+	if n.keyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(n.key), []byte(n.keyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(n.key))
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("private key is encrypted, a passphrase is needed: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return signer, nil
+}
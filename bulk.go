@@ -0,0 +1,77 @@
+package ncclient
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the outcome of an rpc run on one client by RunAll.
+type Result struct {
+	// Reply is the parsed reply, nil if none was received. It is set
+	// alongside an *RPCError when the server reported errors.
+	Reply *RPCReply
+	// Err is why connecting or the rpc failed, nil on success.
+	Err error
+}
+
+// RunAll sends rpc to every client concurrently, running at most
+// concurrency operations at a time, and returns the results keyed by each
+// client's Hostname. Clients that are not connected, or whose session has
+// become unusable, are connected first and left connected afterwards;
+// closed clients are not reopened. A failure on one client does not affect
+// the others; it is reported in that client's Result. A concurrency below
+// 1 runs one client at a time. Clients sharing a hostname overwrite each
+// other's results.
+func RunAll(clients []*Ncclient, rpc string, concurrency int) map[string]Result {
+	return RunAllContext(context.Background(), clients, rpc, concurrency)
+}
+
+// RunAllContext is like RunAll but gives up when ctx is done. Clients not
+// yet started when ctx is done get ctx's error as their Result.
+func RunAllContext(ctx context.Context, clients []*Ncclient, rpc string, concurrency int) map[string]Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]Result, len(clients))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, client := range clients {
+		client := client
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result := runOne(ctx, client, rpc)
+			mu.Lock()
+			results[client.Hostname()] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runOne connects client if needed and sends it rpc.
+func runOne(ctx context.Context, client *Ncclient, rpc string) Result {
+	if err := ctx.Err(); err != nil {
+		return Result{Err: err}
+	}
+	if client.needsConnect() {
+		if err := client.ReconnectContext(ctx); err != nil {
+			return Result{Err: err}
+		}
+	}
+	reply, err := client.rpc(ctx, rpc)
+	return Result{Reply: reply, Err: err}
+}
+
+// needsConnect reports whether the client has no usable session and has
+// not been closed.
+func (n *Ncclient) needsConnect() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !n.closed && !n.connected()
+}
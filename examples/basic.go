@@ -5,6 +5,7 @@ import (
 	"github.com/crazed/ncclient-go"
 	"launchpad.net/xmlpath"
 	"os"
+	"path/filepath"
 )
 
 func main() {
@@ -12,17 +13,32 @@ func main() {
 	password := os.Getenv("PASSWORD")
 	host := os.Getenv("HOST")
 
-	nc := ncclient.MakeClient(username, password, host, 22)
+	// host keys are checked against the user's known_hosts file
+	hostKeyCallback, err := ncclient.KnownHosts(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+	if err != nil {
+		panic(err)
+	}
+
+	// no port is given, so the client connects to the NETCONF port, 830
+	nc, err := ncclient.NewClient(host,
+		ncclient.WithUsername(username),
+		ncclient.WithPassword(password),
+		ncclient.WithHostKeyCallback(hostKeyCallback),
+	)
+	if err != nil {
+		panic(err)
+	}
+	// Connect also exchanges hellos
 	if err := nc.Connect(); err != nil {
 		panic(err)
 	}
 	defer nc.Close()
 
-	// Write a simple Hello to get going
-	nc.SendHello()
-
 	// Request chassis inventory (juniper specific)
-	result := nc.WriteRPC("<get-chassis-inventory/>")
+	result, err := nc.WriteRPC("<get-chassis-inventory/>")
+	if err != nil {
+		panic(err)
+	}
 
 	// Extract some useful information using xmlpath
 	description_path := xmlpath.MustCompile("//chassis/description")
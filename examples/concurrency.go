@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"github.com/crazed/ncclient-go"
 	"io"
+	"launchpad.net/xmlpath"
 	"os"
+	"path/filepath"
 	"strings"
-	"launchpad.net/xmlpath"
 )
 
 type WorkResult struct {
@@ -26,9 +27,14 @@ func worker(id int, jobs <-chan *ncclient.Ncclient, results chan<- *WorkResult)
 			results <- result
 		} else {
 			defer client.Close()
-			client.SendHello()
-			result.output = client.WriteRPC("<get-chassis-inventory/>")
-			result.success = true
+			output, err := client.WriteRPC("<get-chassis-inventory/>")
+			if err != nil {
+				result.success = false
+				result.output = bytes.NewBufferString(err.Error())
+			} else {
+				result.output = output
+				result.success = true
+			}
 			results <- result
 		}
 	}
@@ -47,8 +53,15 @@ func main() {
 		go worker(i, jobs, results)
 	}
 
+	// host keys are checked against the user's known_hosts file
+	hostKeyCallback, err := ncclient.KnownHosts(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+	if err != nil {
+		panic(err)
+	}
+
 	for _, host := range hosts {
-		client := ncclient.MakeClient(username, password, host, 22)
+		// port 0 connects to the NETCONF port, 830
+		client := ncclient.MakeClientWithHostKeyCallback(username, password, host, "", 0, hostKeyCallback)
 		jobs <- &client
 	}
 	close(jobs)
@@ -0,0 +1,260 @@
+package ncclient
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.crypto/ssh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// NewFakeServer starts an in-memory NETCONF over SSH server on a loopback
+// port for testing code that uses this package without a device. It
+// returns the server's host:port and a function that stops it and closes
+// every connection.
+//
+// The server accepts any credentials and any client, speaks end-of-message
+// framing and advertises DefaultCapabilities apart from base:1.1. handler
+// is called with each rpc the server receives and returns the content of
+// its reply, such as "<ok/>" or "<data>...</data>", which the server wraps
+// in an <rpc-reply> echoing the rpc's message-id. close-session is
+// answered by the server itself. handler may be called concurrently for
+// different sessions. Like httptest.NewServer, it panics if it cannot
+// start.
+//
+//	addr, stop := ncclient.NewFakeServer(func(req string) string {
+//		return "<data><system/></data>"
+//	})
+//	defer stop()
+//	host, port, _ := net.SplitHostPort(addr)
+//	portNumber, _ := strconv.Atoi(port)
+//	client, _ := ncclient.NewClient(host,
+//		ncclient.WithPort(portNumber),
+//		ncclient.WithHostKeyCallback(ncclient.InsecureIgnoreHostKey()),
+//	)
+func NewFakeServer(handler func(req string) string) (addr string, stop func()) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("ncclient: fake server failed to generate a host key: %v", err))
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic(fmt.Sprintf("ncclient: fake server failed to generate a host key: %v", err))
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ncclient: fake server failed to listen: %v", err))
+	}
+
+	server := &fakeServer{
+		handler:  handler,
+		config:   config,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	server.wg.Add(1)
+	go server.serve()
+	return listener.Addr().String(), server.stop
+}
+
+// fakeServer is the server run by NewFakeServer.
+type fakeServer struct {
+	handler  func(req string) string
+	config   *ssh.ServerConfig
+	listener net.Listener
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	stopped bool
+
+	sessionID uint64
+	wg        sync.WaitGroup
+}
+
+func (s *fakeServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeServer) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// track records conn so stop can close it, unless the server has stopped.
+func (s *fakeServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *fakeServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// serveConn runs the SSH handshake and accepts session channels.
+func (s *fakeServer) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.serveChannel(channel, requests)
+	}
+}
+
+// serveChannel starts NETCONF on the channel once the netconf subsystem is
+// requested, and refuses every other request.
+func (s *fakeServer) serveChannel(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer s.wg.Done()
+	started := false
+	for req := range requests {
+		// the payload is the subsystem name as an SSH string
+		ok := !started && req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "netconf"
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if ok {
+			started = true
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer channel.Close()
+				s.serveNetconf(channel)
+			}()
+		}
+	}
+	if !started {
+		channel.Close()
+	}
+}
+
+// serveNetconf exchanges hellos and answers rpcs until the client closes
+// the session.
+func (s *fakeServer) serveNetconf(channel io.ReadWriter) {
+	sessionID := atomic.AddUint64(&s.sessionID, 1)
+	if _, err := io.WriteString(channel, fakeServerHello(sessionID)+NETCONF_DELIM); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(channel)
+	var msg bytes.Buffer
+	// the client's hello needs no answer
+	if err := readEOMMessage(r, &msg); err != nil {
+		return
+	}
+	for {
+		msg.Reset()
+		if err := skipSpace(r); err != nil {
+			return
+		}
+		if err := readEOMMessage(r, &msg); err != nil {
+			return
+		}
+		root, err := rootElement(msg.Bytes())
+		if err != nil {
+			return
+		}
+		operation, err := rpcOperation(msg.Bytes())
+		if err != nil {
+			return
+		}
+
+		closing := operation.Local == "close-session"
+		var body string
+		if closing {
+			body = "<ok/>"
+		} else {
+			body = s.handler(msg.String())
+		}
+		reply := fmt.Sprintf(`<rpc-reply xmlns="%s" message-id="%s">%s</rpc-reply>`, NETCONF_NAMESPACE, escapeText(attrValue(root.Attr, "message-id")), body)
+		if _, err := io.WriteString(channel, reply+NETCONF_DELIM); err != nil {
+			return
+		}
+		if closing {
+			return
+		}
+	}
+}
+
+// rpcOperation returns the name of the operation an rpc asks for, the
+// first element inside the <rpc>.
+func rpcOperation(data []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				return t.Name, nil
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// fakeServerHello returns the hello the fake server sends.
+func fakeServerHello(sessionID uint64) string {
+	hello := Hello{SessionID: sessionID}
+	for _, capability := range DefaultCapabilities {
+		if capability != NETCONF_BASE_11 {
+			hello.Capabilities = append(hello.Capabilities, capability)
+		}
+	}
+	// marshaling a Hello cannot fail
+	data, _ := hello.Marshal()
+	return string(data)
+}
@@ -0,0 +1,260 @@
+package ncclient
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectFake starts a fake server answering with handler and returns a
+// client connected to it.
+func connectFake(t *testing.T, handler func(req string) string, opts ...Option) *Ncclient {
+	t.Helper()
+	client := newFakeClient(t, handler, opts...)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newFakeClient starts a fake server answering with handler and returns a
+// client for it, not yet connected.
+func newFakeClient(t *testing.T, handler func(req string) string, opts ...Option) *Ncclient {
+	t.Helper()
+	addr, stop := NewFakeServer(handler)
+	t.Cleanup(stop)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]Option{
+		WithPort(portNumber),
+		WithUsername("admin"),
+		WithHostKeyCallback(InsecureIgnoreHostKey()),
+	}, opts...)
+	client, err := NewClient(host, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestFakeServerHello(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" })
+	if client.SessionID() == 0 {
+		t.Error("SessionID() = 0 after the hello")
+	}
+	if got := client.BaseVersion(); got != "1.0" {
+		t.Errorf("BaseVersion() = %q, want 1.0", got)
+	}
+	for _, capability := range client.Capabilities() {
+		if capability == NETCONF_BASE_11 {
+			t.Error("the fake server advertised base:1.1")
+		}
+	}
+}
+
+func TestFakeServerGet(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	client := connectFake(t, func(req string) string {
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		return `<data><system xmlns="urn:x"><hostname>r1</hostname></system></data>`
+	})
+
+	reply, err := client.Get(`<system xmlns="urn:x"/>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(reply.Data()), `<system xmlns="urn:x"><hostname>r1</hostname></system>`; got != want {
+		t.Errorf("Data() = %s, want %s", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d rpcs, want 1", len(requests))
+	}
+	for _, want := range []string{"<get>", `<filter type="subtree"><system xmlns="urn:x"/></filter>`} {
+		if !strings.Contains(requests[0], want) {
+			t.Errorf("rpc %s does not contain %s", requests[0], want)
+		}
+	}
+}
+
+func TestFakeServerRPCError(t *testing.T) {
+	client := connectFake(t, func(string) string {
+		return `<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity></rpc-error>`
+	})
+	_, err := client.GetConfig("running", "")
+	var rpcError *RPCError
+	if !errors.As(err, &rpcError) {
+		t.Fatalf("got %v, want an *RPCError", err)
+	}
+	if rpcError.Tag != "invalid-value" {
+		t.Errorf("tag = %q, want invalid-value", rpcError.Tag)
+	}
+}
+
+func TestFakeServerCloseSessionInConfig(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" })
+
+	// the text of a config is not an operation, whatever it looks like
+	config := `<config><banner xmlns="urn:x">&lt;close-session/&gt;</banner></config>`
+	if _, err := client.EditConfig("running", config, EditConfigOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Fatalf("session closed by the server: %v", err)
+	}
+	if _, err := client.CloseSession(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeServerCloseSession(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" })
+	if _, err := client.CloseSession(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Connected() {
+		t.Error("Connected() after CloseSession")
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrClosed) {
+		t.Errorf("Get after CloseSession returned %v, want %v", err, ErrClosed)
+	}
+
+	// the client can be connected again
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("Get after reconnecting: %v", err)
+	}
+}
+
+func TestFakeServerWaitForState(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	client := connectFake(t, func(string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		polls++
+		if polls < 3 {
+			return `<data><oper-status>down</oper-status></data>`
+		}
+		return `<data><oper-status>up</oper-status></data>`
+	})
+	up := func(reply *RPCReply) bool {
+		return strings.Contains(string(reply.Data()), "up")
+	}
+	if err := client.WaitForState("", up, time.Millisecond, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	never := func(*RPCReply) bool { return false }
+	if err := client.WaitForState("", never, time.Millisecond, 20*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrTimeout)
+	}
+	if !client.Connected() {
+		t.Error("session unusable after WaitForState timed out")
+	}
+}
+
+func TestFakeServerCloseWakesSynchronousRead(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	client := connectFake(t, func(string) string {
+		received <- struct{}{}
+		<-release
+		return "<ok/>"
+	}, WithSynchronousReads(), WithRPCTimeout(time.Minute))
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Get("")
+		errs <- err
+	}()
+	<-received
+	client.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not wake the operation waiting for its reply")
+	}
+}
+
+func TestFakeServerLargeReply(t *testing.T) {
+	// far beyond the 64KiB a bufio.Scanner line may hold by default
+	large := strings.Repeat("<interface><name>eth0</name></interface>", 20000)
+	client := connectFake(t, func(string) string { return "<data>" + large + "</data>" })
+	reply, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reply.Data()); got != large {
+		t.Errorf("Data() has %d bytes, want %d", len(got), len(large))
+	}
+}
+
+func TestFakeServerMaxResponseSize(t *testing.T) {
+	large := strings.Repeat("<interface><name>eth0</name></interface>", 1000)
+	client := connectFake(t, func(req string) string {
+		if strings.Contains(req, "<large/>") {
+			return "<data>" + large + "</data>"
+		}
+		return "<data/>"
+	}, WithMaxResponseSize(4096))
+
+	if _, err := client.Get(""); err != nil {
+		t.Fatalf("a reply within the limit failed: %v", err)
+	}
+	if _, err := client.Get("<large/>"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("got %v, want %v", err, ErrResponseTooLarge)
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Errorf("got %v, want %v", err, ErrSessionUnusable)
+	}
+}
+
+func TestFakeServerSynchronousReads(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := connectFake(t, func(req string) string {
+		if strings.Contains(req, "<slow/>") {
+			<-release
+		}
+		return "<data><a/></data>"
+	}, WithSynchronousReads(), WithRPCTimeout(200*time.Millisecond))
+
+	reply, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reply.Data()); got != "<a/>" {
+		t.Errorf("Data() = %q, want <a/>", got)
+	}
+
+	// SSH has no read deadline, so the read is ended by closing the session
+	if _, err := client.Get("<slow/>"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrTimeout)
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Errorf("got %v, want %v", err, ErrSessionUnusable)
+	}
+}
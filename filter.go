@@ -0,0 +1,173 @@
+package ncclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Filter selects part of a datastore in Get and GetConfig. The zero value
+// selects everything, unless the client has a default filter set with
+// WithDefaultFilter; AllFilter selects everything regardless.
+type Filter struct {
+	// Type is "subtree" or "xpath".
+	Type string
+	// Subtree is the content of a subtree filter.
+	Subtree string
+	// Select is the XPath expression of an xpath filter.
+	Select string
+	// Namespaces maps the prefixes used in Select to namespace URIs.
+	Namespaces map[string]string
+}
+
+// AllFilter selects everything even when the client has a default filter,
+// for the calls that need the whole datastore.
+var AllFilter = Filter{Type: "all"}
+
+// SubtreeFilter returns a subtree filter with the given content. An empty
+// content selects everything.
+func SubtreeFilter(content string) Filter {
+	if content == "" {
+		return Filter{}
+	}
+	return Filter{Type: "subtree", Subtree: content}
+}
+
+// SubtreePath returns a subtree filter selecting the element at path in the
+// YANG module with the given namespace, saving building namespaced filter
+// XML by hand. path is a slash separated list of element names, each
+// optionally followed by one or more [name=value] content matches:
+//
+//	SubtreePath("urn:ietf:params:xml:ns:yang:ietf-interfaces", "interfaces/interface[name=eth0]/mtu")
+//
+// selects the mtu of interface eth0 with
+//
+//	<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><mtu/></interface></interfaces>
+//
+// Values are escaped and may contain slashes but not "]". Use
+// SubtreeFilter for anything a path cannot express.
+func SubtreePath(namespace string, path string) (Filter, error) {
+	if namespace == "" {
+		return Filter{}, fmt.Errorf("empty namespace in subtree path %q", path)
+	}
+	steps, err := parseSubtreePath(path)
+	if err != nil {
+		return Filter{}, err
+	}
+
+	var content strings.Builder
+	for i, step := range steps {
+		content.WriteString("<" + step.name)
+		if i == 0 {
+			fmt.Fprintf(&content, ` xmlns="%s"`, escapeText(namespace))
+		}
+		if i == len(steps)-1 && len(step.matches) == 0 {
+			content.WriteString("/>")
+			break
+		}
+		content.WriteString(">")
+		for _, match := range step.matches {
+			fmt.Fprintf(&content, "<%s>%s</%s>", match[0], escapeText(match[1]), match[0])
+		}
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if i < len(steps)-1 || len(steps[i].matches) > 0 {
+			content.WriteString("</" + steps[i].name + ">")
+		}
+	}
+	return SubtreeFilter(content.String()), nil
+}
+
+// subtreeStep is one element of a path given to SubtreePath, with its
+// content matches as name, value pairs.
+type subtreeStep struct {
+	name    string
+	matches [][2]string
+}
+
+// parseSubtreePath splits a path given to SubtreePath into its steps.
+func parseSubtreePath(path string) ([]subtreeStep, error) {
+	var steps []subtreeStep
+	rest := path
+	for {
+		end := strings.IndexAny(rest, "/[")
+		if end < 0 {
+			end = len(rest)
+		}
+		step := subtreeStep{name: rest[:end]}
+		if !validElementName(step.name) {
+			return nil, fmt.Errorf("invalid element name %q in subtree path %q", step.name, path)
+		}
+		rest = rest[end:]
+		for strings.HasPrefix(rest, "[") {
+			closing := strings.Index(rest, "]")
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated match in subtree path %q", path)
+			}
+			match := strings.SplitN(rest[1:closing], "=", 2)
+			if len(match) != 2 || !validElementName(match[0]) {
+				return nil, fmt.Errorf("invalid match %q in subtree path %q: must be [name=value]", rest[:closing+1], path)
+			}
+			step.matches = append(step.matches, [2]string{match[0], match[1]})
+			rest = rest[closing+1:]
+		}
+		steps = append(steps, step)
+		if rest == "" {
+			return steps, nil
+		}
+		if rest[0] != '/' {
+			return nil, fmt.Errorf("unexpected %q in subtree path %q", rest, path)
+		}
+		rest = rest[1:]
+	}
+}
+
+// validElementName reports whether name can be used as an element name in a
+// subtree filter. It only rules out what would break the XML.
+func validElementName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n<>&\"'=/[]")
+}
+
+// XPathFilter returns an xpath filter selecting expr. namespaces maps the
+// prefixes used in expr to namespace URIs and may be nil.
+func XPathFilter(expr string, namespaces map[string]string) Filter {
+	return Filter{Type: "xpath", Select: expr, Namespaces: namespaces}
+}
+
+// orDefault returns f, or the client's default filter if f is the zero
+// Filter.
+func (f Filter) orDefault(n *Ncclient) Filter {
+	if f.Type == "" {
+		return n.defaultFilter
+	}
+	return f
+}
+
+// render returns the <filter> element for f, or nothing for the zero
+// Filter and AllFilter. XPath filters need the server to advertise the
+// xpath capability.
+func (f Filter) render(n *Ncclient) (string, error) {
+	switch f.Type {
+	case "", "all":
+		return "", nil
+	case "subtree":
+		return fmt.Sprintf(`<filter type="subtree">%s</filter>`, f.Subtree), nil
+	case "xpath":
+		if err := n.requireCapability(CAPABILITY_XPATH); err != nil {
+			return "", err
+		}
+		var filter strings.Builder
+		filter.WriteString(`<filter type="xpath"`)
+		prefixes := make([]string, 0, len(f.Namespaces))
+		for prefix := range f.Namespaces {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			fmt.Fprintf(&filter, ` xmlns:%s="%s"`, prefix, escapeText(f.Namespaces[prefix]))
+		}
+		fmt.Fprintf(&filter, ` select="%s"/>`, escapeText(f.Select))
+		return filter.String(), nil
+	}
+	return "", fmt.Errorf("invalid filter type %q: must be subtree or xpath", f.Type)
+}
@@ -0,0 +1,39 @@
+package ncclient
+
+import "testing"
+
+func TestSubtreePath(t *testing.T) {
+	const ns = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"interfaces", `<interfaces xmlns="` + ns + `"/>`},
+		{"interfaces/interface", `<interfaces xmlns="` + ns + `"><interface/></interfaces>`},
+		{"interfaces/interface[name=eth0]/mtu", `<interfaces xmlns="` + ns + `"><interface><name>eth0</name><mtu/></interface></interfaces>`},
+		{"interfaces/interface[name=eth0]", `<interfaces xmlns="` + ns + `"><interface><name>eth0</name></interface></interfaces>`},
+		{"a[x=1][y=2]", `<a xmlns="` + ns + `"><x>1</x><y>2</y></a>`},
+		{"a[name=ge-0/0/0 & <b>]", `<a xmlns="` + ns + `"><name>ge-0/0/0 &amp; &lt;b&gt;</name></a>`},
+	}
+	for _, test := range tests {
+		filter, err := SubtreePath(ns, test.path)
+		if err != nil {
+			t.Errorf("SubtreePath(%q): %v", test.path, err)
+			continue
+		}
+		if filter.Type != "subtree" || filter.Subtree != test.want {
+			t.Errorf("SubtreePath(%q) = %+v, want subtree %s", test.path, filter, test.want)
+		}
+	}
+}
+
+func TestSubtreePathInvalid(t *testing.T) {
+	for _, path := range []string{"", "a//b", "a/", "/a", "a[name=x", "a[=x]", "a[name]", "a[name=x]b", "a b"} {
+		if filter, err := SubtreePath("urn:x", path); err == nil {
+			t.Errorf("SubtreePath(%q) = %+v, want an error", path, filter)
+		}
+	}
+	if _, err := SubtreePath("", "a"); err == nil {
+		t.Error("SubtreePath with an empty namespace succeeded")
+	}
+}
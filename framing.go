@@ -0,0 +1,246 @@
+package ncclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const NETCONF_BASE_10 string = "urn:ietf:params:netconf:base:1.0"
+const NETCONF_BASE_11 string = "urn:ietf:params:netconf:base:1.1"
+
+// NETCONF_NAMESPACE is the XML namespace of the base protocol elements.
+const NETCONF_NAMESPACE string = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+// framingMode selects how messages are delimited on the wire (RFC 6242).
+type framingMode int32
+
+const (
+	// framingEOM terminates every message with NETCONF_DELIM (base:1.0).
+	framingEOM framingMode = iota
+	// framingChunked sends messages as length-prefixed chunks (base:1.1).
+	framingChunked
+)
+
+// maxChunkSize is the largest chunk-size permitted by RFC 6242.
+const maxChunkSize = 4294967295
+
+var errBadChunk = errors.New("malformed chunked framing")
+
+// encodeMessage frames the message made of parts for the wire according to
+// mode. The parts are not copied; the framing goes around them.
+func encodeMessage(mode framingMode, parts ...[]byte) net.Buffers {
+	if mode == framingChunked {
+		size := 0
+		for _, part := range parts {
+			size += len(part)
+		}
+		message := net.Buffers{[]byte(fmt.Sprintf("\n#%d\n", size))}
+		return append(append(message, parts...), []byte("\n##\n"))
+	}
+	return append(append(net.Buffers{}, parts...), []byte(NETCONF_DELIM))
+}
+
+// setFraming switches the framing used for following messages sent. The
+// session reader switches the framing it decodes with by itself.
+func (n *Ncclient) setFraming(mode framingMode) {
+	atomic.StoreInt32((*int32)(&n.framing), int32(mode))
+}
+
+func (n *Ncclient) currentFraming() framingMode {
+	return framingMode(atomic.LoadInt32((*int32)(&n.framing)))
+}
+
+// readEOMMessage decodes a single end-of-message framed message from r into
+// w. The delimiter is searched for in the raw byte stream, so it need not be
+// on a line of its own and no line or message length limit applies. Only
+// the few bytes that could be the start of the delimiter are held back, so
+// w receives the message as it arrives.
+func readEOMMessage(r *bufio.Reader, w io.Writer) error {
+	return readEOMMessageWithFallback(r, w, nil)
+}
+
+// delimiterFallback ends a message that lacks its delimiter once it holds a
+// complete <rpc-reply> or <hello> and nothing more arrives for grace.
+type delimiterFallback struct {
+	source *pumpReader
+	grace  time.Duration
+	// message collects the message read so far
+	message bytes.Buffer
+}
+
+// complete reports whether the message read so far is a whole reply that
+// no more data followed within the grace period.
+func (f *delimiterFallback) complete(r *bufio.Reader) bool {
+	if r.Buffered() > 0 || !completeReply(f.message.Bytes()) {
+		return false
+	}
+	return !f.source.wait(f.grace)
+}
+
+// completeReply reports whether data is a single well-formed <rpc-reply>
+// or <hello> element, possibly followed by whitespace.
+func completeReply(data []byte) bool {
+	trimmed := bytes.TrimRight(data, " \t\r\n")
+	if !bytes.HasSuffix(trimmed, []byte("rpc-reply>")) && !bytes.HasSuffix(trimmed, []byte("hello>")) {
+		return false
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	var root string
+	closed := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return closed && (root == "rpc-reply" || root == "hello")
+		}
+		if err != nil {
+			return false
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if closed {
+				return false
+			}
+			if depth == 0 {
+				root = t.Name.Local
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				closed = true
+			}
+		}
+	}
+}
+
+// readEOMMessageWithFallback is readEOMMessage, also ending the message
+// without its delimiter as fallback allows when fallback is not nil.
+func readEOMMessageWithFallback(r *bufio.Reader, w io.Writer, fallback *delimiterFallback) error {
+	delim := []byte(NETCONF_DELIM)
+	keep := len(delim) - 1
+	var tail []byte
+	for {
+		// the delimiter ends in '>', so it can only end a slice read up to one
+		data, err := r.ReadSlice('>')
+		tail = append(tail, data...)
+		if bytes.HasSuffix(tail, delim) {
+			_, err := w.Write(tail[:len(tail)-len(delim)])
+			return err
+		}
+		if len(tail) > keep {
+			if _, err := w.Write(tail[:len(tail)-keep]); err != nil {
+				return err
+			}
+			tail = append(tail[:0], tail[len(tail)-keep:]...)
+		}
+		if fallback != nil {
+			fallback.message.Write(data)
+			if err == nil && fallback.complete(r) {
+				_, err := w.Write(tail)
+				return err
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			// hand over what was read, a reply cut off by the server
+			// hanging up may still be whole apart from its delimiter
+			if _, err := w.Write(tail); err != nil {
+				return err
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readChunkedMessage decodes a single chunked-framed message from r into w.
+// Chunk data is copied with io.CopyN so a chunk split across several
+// underlying reads is handled transparently.
+func readChunkedMessage(r *bufio.Reader, w io.Writer) error {
+	for {
+		size, err := readChunkHeader(r)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// readChunkHeader consumes a chunk header ("\n#<size>\n") and returns the
+// chunk size, or consumes an end-of-chunks marker ("\n##\n") and returns 0.
+// The leading LF is optional because the session reader may already have
+// consumed it while skipping whitespace between messages.
+func readChunkHeader(r *bufio.Reader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	if c != '#' {
+		return 0, errBadChunk
+	}
+
+	c, err = r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == '#' {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		if c != '\n' {
+			return 0, errBadChunk
+		}
+		return 0, nil
+	}
+	if err := r.UnreadByte(); err != nil {
+		return 0, err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	digits := line[:len(line)-1]
+	// chunk-size has no leading zeros and no sign (RFC 6242 section 4.2)
+	if digits == "" || len(digits) > 10 || digits[0] < '1' || digits[0] > '9' {
+		return 0, errBadChunk
+	}
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size > maxChunkSize {
+		return 0, errBadChunk
+	}
+	return size, nil
+}
+
+// negotiateFraming picks chunked framing only when both peers advertise
+// base:1.1, as required by RFC 6242 section 4.1.
+func negotiateFraming(local []string, remote []string) framingMode {
+	if containsString(local, NETCONF_BASE_11) && containsString(remote, NETCONF_BASE_11) {
+		return framingChunked
+	}
+	return framingEOM
+}
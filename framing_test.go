@@ -0,0 +1,169 @@
+package ncclient
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadChunkHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		size  int64
+		err   error
+	}{
+		{"\n#5\n", 5, nil},
+		{"#5\n", 5, nil},
+		{"\n#4294967295\n", maxChunkSize, nil},
+		{"\n##\n", 0, nil},
+		{"\n#0\n", 0, errBadChunk},
+		{"\n#05\n", 0, errBadChunk},
+		{"\n#-5\n", 0, errBadChunk},
+		{"\n#4294967296\n", 0, errBadChunk},
+		{"\n#\n", 0, errBadChunk},
+		{"\n5\n", 0, errBadChunk},
+		{"\n##x", 0, errBadChunk},
+		{"\n#5", 0, io.EOF},
+	}
+	for _, test := range tests {
+		size, err := readChunkHeader(bufio.NewReader(strings.NewReader(test.input)))
+		if size != test.size || err != test.err {
+			t.Errorf("readChunkHeader(%q) = %d, %v, want %d, %v", test.input, size, err, test.size, test.err)
+		}
+	}
+}
+
+func TestReadChunkedMessage(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\n#4\n<rpc\n#18\n-reply><ok/></rpc-\n#6\nreply>\n##\n\n#2\nab\n##\n"))
+	var message bytes.Buffer
+	if err := readChunkedMessage(r, &message); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := message.String(), "<rpc-reply><ok/></rpc-reply>"; got != want {
+		t.Errorf("first message = %q, want %q", got, want)
+	}
+
+	message.Reset()
+	if err := readChunkedMessage(r, &message); err != nil {
+		t.Fatal(err)
+	}
+	if got := message.String(); got != "ab" {
+		t.Errorf("second message = %q, want %q", got, "ab")
+	}
+}
+
+func TestReadChunkedMessageTruncated(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\n#10\nabc"))
+	if err := readChunkedMessage(r, io.Discard); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	parts := [][]byte{[]byte("<a>"), []byte("</a>")}
+	tests := []struct {
+		mode framingMode
+		want string
+	}{
+		{framingEOM, "<a></a>]]>]]>"},
+		{framingChunked, "\n#7\n<a></a>\n##\n"},
+	}
+	for _, test := range tests {
+		if got := bytes.Join(encodeMessage(test.mode, parts...), nil); string(got) != test.want {
+			t.Errorf("encodeMessage(%v) = %q, want %q", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestReadEOMMessage(t *testing.T) {
+	// the delimiter is split across reads and a partial delimiter appears
+	// inside the message
+	input := "<a>]]>]]</a>]]>]]>\n<b/>]]>]]>"
+	r := bufio.NewReaderSize(&oneByteReader{strings.NewReader(input)}, 16)
+	var message bytes.Buffer
+	if err := readEOMMessage(r, &message); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := message.String(), "<a>]]>]]</a>"; got != want {
+		t.Errorf("first message = %q, want %q", got, want)
+	}
+
+	if err := skipSpace(r); err != nil {
+		t.Fatal(err)
+	}
+	message.Reset()
+	if err := readEOMMessage(r, &message); err != nil {
+		t.Fatal(err)
+	}
+	if got := message.String(); got != "<b/>" {
+		t.Errorf("second message = %q, want %q", got, "<b/>")
+	}
+}
+
+func TestReadEOMMessageEOF(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("<rpc-reply><ok/></rpc-reply>]]>"))
+	var message bytes.Buffer
+	if err := readEOMMessage(r, &message); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	// everything read is handed over, held back delimiter bytes included
+	if got, want := message.String(), "<rpc-reply><ok/></rpc-reply>]]>"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
+
+func TestReadEOMMessageWithFallback(t *testing.T) {
+	client, server := io.Pipe()
+	defer server.Close()
+	source := newPumpReader(client)
+	r := bufio.NewReader(source)
+
+	go io.WriteString(server, `<rpc-reply message-id="1"><ok/></rpc-reply>`)
+
+	var message bytes.Buffer
+	fallback := &delimiterFallback{source: source, grace: 50 * time.Millisecond}
+	if err := readEOMMessageWithFallback(r, &message, fallback); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := message.String(), `<rpc-reply message-id="1"><ok/></rpc-reply>`; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
+
+func TestReadEOMMessageWithFallbackWaitsForDelimiter(t *testing.T) {
+	client, server := io.Pipe()
+	defer server.Close()
+	source := newPumpReader(client)
+	r := bufio.NewReader(source)
+
+	// an incomplete reply is never ended without its delimiter
+	go func() {
+		io.WriteString(server, `<rpc-reply message-id="1"><data>`)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(server, `</data></rpc-reply>]]>]]>`)
+	}()
+
+	var message bytes.Buffer
+	fallback := &delimiterFallback{source: source, grace: 10 * time.Millisecond}
+	if err := readEOMMessageWithFallback(r, &message, fallback); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := message.String(), `<rpc-reply message-id="1"><data></data></rpc-reply>`; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
+
+// oneByteReader returns at most one byte per Read.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
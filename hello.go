@@ -0,0 +1,309 @@
+package ncclient
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const CAPABILITY_XPATH string = "urn:ietf:params:netconf:capability:xpath:1.0"
+const CAPABILITY_URL string = "urn:ietf:params:netconf:capability:url:1.0"
+const CAPABILITY_WRITABLE_RUNNING string = "urn:ietf:params:netconf:capability:writable-running:1.0"
+const CAPABILITY_CANDIDATE string = "urn:ietf:params:netconf:capability:candidate:1.0"
+const CAPABILITY_CONFIRMED_COMMIT_10 string = "urn:ietf:params:netconf:capability:confirmed-commit:1.0"
+const CAPABILITY_CONFIRMED_COMMIT_11 string = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+const CAPABILITY_ROLLBACK_ON_ERROR string = "urn:ietf:params:netconf:capability:rollback-on-error:1.0"
+const CAPABILITY_VALIDATE_10 string = "urn:ietf:params:netconf:capability:validate:1.0"
+const CAPABILITY_VALIDATE_11 string = "urn:ietf:params:netconf:capability:validate:1.1"
+const CAPABILITY_STARTUP string = "urn:ietf:params:netconf:capability:startup:1.0"
+const CAPABILITY_NOTIFICATION string = "urn:ietf:params:netconf:capability:notification:1.0"
+const CAPABILITY_WITH_DEFAULTS string = "urn:ietf:params:netconf:capability:with-defaults:1.0"
+const CAPABILITY_MONITORING string = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+
+// ErrUnsupportedCapability is returned, wrapped with the capability URN,
+// when an operation needs a capability the server did not advertise.
+var ErrUnsupportedCapability = errors.New("server does not advertise capability")
+
+// DefaultCapabilities are the capabilities advertised in the client hello
+// unless overridden with WithCapabilities. Both base versions are
+// advertised, so chunked framing is used with servers that support
+// base:1.1.
+var DefaultCapabilities = []string{
+	NETCONF_BASE_10,
+	NETCONF_BASE_11,
+	CAPABILITY_WRITABLE_RUNNING,
+	CAPABILITY_CANDIDATE,
+	CAPABILITY_CONFIRMED_COMMIT_10,
+	CAPABILITY_ROLLBACK_ON_ERROR,
+	CAPABILITY_VALIDATE_10,
+	CAPABILITY_STARTUP,
+	CAPABILITY_URL + "?scheme=http,ftp,file,https,sftp",
+	CAPABILITY_XPATH,
+	"urn:ietf:params:netconf:capability:interleave:1.0",
+}
+
+// Hello is a <hello> message. Clients leave SessionID zero; servers set it
+// to the session-id they assign. It marshals with encoding/xml into the
+// NETCONF base namespace.
+type Hello struct {
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    uint64   `xml:"session-id,omitempty"`
+}
+
+// MarshalXML renders h as a <hello> element in the base namespace.
+func (h Hello) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(struct {
+		XMLName      xml.Name `xml:"hello"`
+		Namespace    string   `xml:"xmlns,attr"`
+		Capabilities []string `xml:"capabilities>capability"`
+		SessionID    uint64   `xml:"session-id,omitempty"`
+	}{Namespace: NETCONF_NAMESPACE, Capabilities: h.Capabilities, SessionID: h.SessionID})
+}
+
+// Marshal returns h as a complete message, XML declaration included.
+func (h Hello) Marshal() ([]byte, error) {
+	data, err := xml.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseHello parses a <hello> message. The whitespace pretty printing
+// often leaves around capabilities is dropped.
+func ParseHello(data []byte) (*Hello, error) {
+	hello := new(Hello)
+	if err := xml.Unmarshal(data, hello); err != nil {
+		return nil, err
+	}
+	for i, capability := range hello.Capabilities {
+		hello.Capabilities[i] = strings.TrimSpace(capability)
+	}
+	return hello, nil
+}
+
+// localCapabilities returns the capabilities this client advertises.
+func (n *Ncclient) localCapabilities() []string {
+	capabilities := DefaultCapabilities
+	if n.clientCapabilities != nil {
+		capabilities = n.clientCapabilities
+	}
+	if !n.forceBase10 {
+		return capabilities
+	}
+	var base10 []string
+	for _, capability := range capabilities {
+		if capability != NETCONF_BASE_11 {
+			base10 = append(base10, capability)
+		}
+	}
+	return base10
+}
+
+// Capabilities returns the capabilities advertised by the server in its
+// hello, in a slice the caller may modify. It is nil until SendHello has
+// completed.
+func (n *Ncclient) Capabilities() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.capabilities == nil {
+		// requireCapability takes nil to mean the hello has not happened
+		return nil
+	}
+	return append([]string{}, n.capabilities...)
+}
+
+// RefreshCapabilities reads the server's capabilities again, for devices
+// that change them without dropping the session, for example after a
+// license is installed, and returns them. NETCONF only exchanges hellos
+// once per session, so a server advertising ietf-netconf-monitoring is
+// asked for its current capabilities with a get of
+// /netconf-state/capabilities, and any other server is reconnected to, as
+// Reconnect does, to read them from a new hello.
+func (n *Ncclient) RefreshCapabilities() ([]string, error) {
+	return n.RefreshCapabilitiesContext(context.Background())
+}
+
+// RefreshCapabilitiesContext is like RefreshCapabilities but gives up when
+// ctx is done.
+func (n *Ncclient) RefreshCapabilitiesContext(ctx context.Context) ([]string, error) {
+	if !n.HasCapability(CAPABILITY_MONITORING) {
+		if err := n.ReconnectContext(ctx); err != nil {
+			return nil, err
+		}
+		return n.Capabilities(), nil
+	}
+
+	reply, err := n.GetWithFilterContext(ctx, SubtreeFilter(fmt.Sprintf(`<netconf-state xmlns="%s"><capabilities/></netconf-state>`, CAPABILITY_MONITORING)))
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Capabilities []string `xml:"netconf-state>capabilities>capability"`
+	}
+	if err := xml.Unmarshal([]byte("<data>"+string(reply.Data())+"</data>"), &data); err != nil {
+		return nil, fmt.Errorf("invalid capabilities: %w", err)
+	}
+	if len(data.Capabilities) == 0 {
+		return nil, fmt.Errorf("server reported no capabilities")
+	}
+	capabilities := make([]string, len(data.Capabilities))
+	for i, capability := range data.Capabilities {
+		capabilities[i] = strings.TrimSpace(capability)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.capabilities = capabilities
+	return capabilities, nil
+}
+
+// HasCapability reports whether the server advertised the capability urn.
+// Any parameters on the advertised capability (the part after "?") are
+// ignored, so "urn:ietf:params:netconf:capability:url:1.0" matches a server
+// advertising url:1.0 with a scheme list.
+func (n *Ncclient) HasCapability(urn string) bool {
+	for _, capability := range n.Capabilities() {
+		if capability == urn || strings.HasPrefix(capability, urn+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCapability splits a capability URI into its base URN and the
+// parameters after the "?", such as the scheme list of the url capability
+// or the module and revision of a YANG module capability. Parameter values
+// are percent-decoded. params is empty, not nil, when there are none.
+func ParseCapability(capability string) (base string, params map[string]string) {
+	params = make(map[string]string)
+	base, query, found := strings.Cut(capability, "?")
+	if !found {
+		return base, params
+	}
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(param, "=")
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		params[key] = value
+	}
+	return base, params
+}
+
+// CapabilityParams returns the parameters of the capability with the base
+// URN base the server advertised, see ParseCapability, and whether it
+// advertised one at all:
+//
+//	params, ok := client.CapabilityParams(ncclient.CAPABILITY_URL)
+//	schemes := strings.Split(params["scheme"], ",")
+func (n *Ncclient) CapabilityParams(base string) (map[string]string, bool) {
+	for _, capability := range n.Capabilities() {
+		if capabilityBase, params := ParseCapability(capability); capabilityBase == base {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// CapabilityDiff compares the capabilities the servers of a and b
+// advertised, for example to find what a migration from one device to the
+// other has to do without. It returns the capabilities only a has, only b
+// has and both have, each sorted. Capabilities are compared as whole
+// URIs, so one advertised with different parameters, such as another
+// module revision, is in both onlyA and onlyB. A client that has not
+// exchanged hellos has no capabilities.
+func CapabilityDiff(a, b *Ncclient) (onlyA, onlyB, common []string) {
+	inA := make(map[string]bool)
+	for _, capability := range a.Capabilities() {
+		inA[capability] = true
+	}
+	inB := make(map[string]bool)
+	for _, capability := range b.Capabilities() {
+		inB[capability] = true
+	}
+	for capability := range inA {
+		if inB[capability] {
+			common = append(common, capability)
+		} else {
+			onlyA = append(onlyA, capability)
+		}
+	}
+	for capability := range inB {
+		if !inA[capability] {
+			onlyB = append(onlyB, capability)
+		}
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	sort.Strings(common)
+	return onlyA, onlyB, common
+}
+
+// requireCapability returns an error if the server advertised none of
+// urns, so operations fail up front rather than with an obscure rpc-error.
+// Before the hello exchange nothing is known about the server, and the
+// operation fails anyway, so no error is returned.
+func (n *Ncclient) requireCapability(urns ...string) error {
+	if n.Capabilities() == nil {
+		return nil
+	}
+	for _, urn := range urns {
+		if n.HasCapability(urn) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", ErrUnsupportedCapability, strings.Join(urns, " or "))
+}
+
+// requireDatastore returns an error if the server does not have the
+// datastore name, candidate or startup, or, when writing, cannot write
+// running directly. Anything else, such as a URL, is left to the caller.
+func (n *Ncclient) requireDatastore(name string, writing bool) error {
+	urn, ok := datastoreCapability[name]
+	if !ok || name == "running" && !writing {
+		return nil
+	}
+	return n.requireCapability(urn)
+}
+
+// SessionID returns the session-id assigned by the server in its hello, or
+// 0 before the hellos have been exchanged. It is what other sessions pass to
+// KillSession to end this one.
+func (n *Ncclient) SessionID() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sessionID
+}
+
+// BaseVersion returns the NETCONF base protocol version negotiated in the
+// hello exchange, "1.0" or "1.1", or "" before the hellos have been
+// exchanged. Version 1.1 is used only when both peers advertise it, and
+// selects chunked framing.
+func (n *Ncclient) BaseVersion() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.serverHello == nil {
+		return ""
+	}
+	if n.currentFraming() == framingChunked {
+		return "1.1"
+	}
+	return "1.0"
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package ncclient
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestParseCapability(t *testing.T) {
+	tests := []struct {
+		capability string
+		base       string
+		params     map[string]string
+	}{
+		{CAPABILITY_CANDIDATE, CAPABILITY_CANDIDATE, map[string]string{}},
+		{CAPABILITY_URL + "?scheme=file,sftp", CAPABILITY_URL, map[string]string{"scheme": "file,sftp"}},
+		{
+			"urn:ietf:params:xml:ns:yang:ietf-interfaces?module=ietf-interfaces&revision=2014-05-08&features=arbitrary-names,pre-provisioning",
+			"urn:ietf:params:xml:ns:yang:ietf-interfaces",
+			map[string]string{"module": "ietf-interfaces", "revision": "2014-05-08", "features": "arbitrary-names,pre-provisioning"},
+		},
+		{CAPABILITY_WITH_DEFAULTS + "?basic-mode=explicit&also-supported=report-all%2Ctrim", CAPABILITY_WITH_DEFAULTS, map[string]string{"basic-mode": "explicit", "also-supported": "report-all,trim"}},
+		{"urn:x?&flag&", "urn:x", map[string]string{"flag": ""}},
+	}
+	for _, test := range tests {
+		base, params := ParseCapability(test.capability)
+		if base != test.base || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("ParseCapability(%q) = %q, %v, want %q, %v", test.capability, base, params, test.base, test.params)
+		}
+	}
+}
+
+func TestCapabilitiesCopy(t *testing.T) {
+	n := &Ncclient{mu: new(sync.Mutex)}
+	if n.Capabilities() != nil {
+		t.Error("Capabilities() before the hello is not nil")
+	}
+	n.capabilities = []string{}
+	if n.Capabilities() == nil {
+		t.Error("Capabilities() of a server advertising none is nil")
+	}
+	n.capabilities = []string{NETCONF_BASE_10, CAPABILITY_CANDIDATE}
+	n.Capabilities()[1] = CAPABILITY_STARTUP
+	if !n.HasCapability(CAPABILITY_CANDIDATE) {
+		t.Error("modifying the result of Capabilities() changed the client's capabilities")
+	}
+}
+
+func TestNegotiateFraming(t *testing.T) {
+	both := []string{NETCONF_BASE_10, NETCONF_BASE_11}
+	only10 := []string{NETCONF_BASE_10}
+	if negotiateFraming(both, both) != framingChunked {
+		t.Error("base:1.1 on both sides did not select chunked framing")
+	}
+	if negotiateFraming(both, only10) != framingEOM || negotiateFraming(only10, both) != framingEOM {
+		t.Error("base:1.1 on one side selected chunked framing")
+	}
+}
+
+func TestChunkedSession(t *testing.T) {
+	hello, err := Hello{SessionID: 1, Capabilities: []string{NETCONF_BASE_10, NETCONF_BASE_11}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := connectPipeWithHello(t, string(hello), func(s *pipeServer) {
+		var req bytes.Buffer
+		if err := readChunkedMessage(s.r, &req); err != nil {
+			return
+		}
+		root, err := rootElement(req.Bytes())
+		if err != nil {
+			return
+		}
+		reply := replyWithID(attrValue(root.Attr, "message-id"), "<data><a/></data>")
+		message := encodeMessage(framingChunked, []byte(reply))
+		message.WriteTo(s.conn)
+	})
+
+	if got := client.BaseVersion(); got != "1.1" {
+		t.Errorf("BaseVersion() = %q, want 1.1", got)
+	}
+	reply, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reply.Data()); got != "<a/>" {
+		t.Errorf("Data() = %q, want <a/>", got)
+	}
+}
+
+func TestBase10(t *testing.T) {
+	n, err := NewClient("r1", WithBase10())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(n.localCapabilities(), NETCONF_BASE_11) {
+		t.Error("WithBase10 advertised base:1.1")
+	}
+}
+
+func TestCapabilityDiff(t *testing.T) {
+	a := &Ncclient{mu: new(sync.Mutex), capabilities: []string{"urn:x", "urn:v", "urn:c"}}
+	b := &Ncclient{mu: new(sync.Mutex), capabilities: []string{"urn:c", "urn:y"}}
+	onlyA, onlyB, common := CapabilityDiff(a, b)
+	if !reflect.DeepEqual(onlyA, []string{"urn:v", "urn:x"}) || !reflect.DeepEqual(onlyB, []string{"urn:y"}) || !reflect.DeepEqual(common, []string{"urn:c"}) {
+		t.Errorf("CapabilityDiff = %v, %v, %v", onlyA, onlyB, common)
+	}
+}
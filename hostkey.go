@@ -0,0 +1,34 @@
+package ncclient
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"code.google.com/p/go.crypto/ssh/knownhosts"
+	"errors"
+	"net"
+)
+
+// ErrNoHostKeyCallback is returned when connecting without a way to verify
+// the server's host key.
+var ErrNoHostKeyCallback = errors.New("no HostKeyCallback configured: refusing to trust the server host key")
+
+// rejectHostKey is the default host key check; it fails every connection so
+// that trusting unknown servers is always an explicit choice.
+func rejectHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	return ErrNoHostKeyCallback
+}
+
+// InsecureIgnoreHostKey returns a HostKeyCallback that accepts any host key.
+// It leaves connections open to man-in-the-middle attacks and should only be
+// used for testing or on fully trusted networks.
+func InsecureIgnoreHostKey() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return nil
+	}
+}
+
+// KnownHosts returns a HostKeyCallback that checks host keys against the
+// given OpenSSH known_hosts files, such as ~/.ssh/known_hosts. With no
+// files every host key is unknown, so every connection is refused.
+func KnownHosts(files ...string) (ssh.HostKeyCallback, error) {
+	return knownhosts.New(files...)
+}
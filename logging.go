@@ -0,0 +1,76 @@
+package ncclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Directions passed to a LogFunc.
+const (
+	LogSend    = "send"
+	LogReceive = "receive"
+)
+
+// LogFunc receives a copy of each message exchanged by Write. Sent messages
+// are logged exactly as written, framing included; received messages are
+// logged once the framing has been decoded.
+type LogFunc func(direction string, payload string)
+
+// SetLogger makes Write call logger with every message it sends and every
+// reply it receives. A nil logger, the default, turns logging off.
+func (n *Ncclient) SetLogger(logger LogFunc) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.logger = logger
+}
+
+func (n *Ncclient) log(direction string, payload string) {
+	if n.logger != nil {
+		n.logger(direction, payload)
+	}
+}
+
+// captureTransport copies every byte read from and written to a transport
+// to w, see WithTrafficCapture.
+type captureTransport struct {
+	Transport
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (t *captureTransport) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+	if n > 0 {
+		t.record(LogReceive, p[:n])
+	}
+	return n, err
+}
+
+func (t *captureTransport) Write(p []byte) (int, error) {
+	n, err := t.Transport.Write(p)
+	if n > 0 {
+		t.record(LogSend, p[:n])
+	}
+	return n, err
+}
+
+// SetReadDeadline passes a read deadline on to the transport, if it
+// supports one.
+func (t *captureTransport) SetReadDeadline(deadline time.Time) error {
+	if conn, ok := t.Transport.(readDeadliner); ok {
+		return conn.SetReadDeadline(deadline)
+	}
+	return errors.New("transport has no read deadline")
+}
+
+// record writes a header line with the time, direction and length, then
+// the bytes themselves and a newline. Errors writing the capture are
+// ignored so they cannot break the session.
+func (t *captureTransport) record(direction string, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %s %d\n%s\n", time.Now().UTC().Format(time.RFC3339Nano), direction, len(p), p)
+}
@@ -0,0 +1,78 @@
+package ncclient
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SessionInfo describes a NETCONF session open on the server, as listed in
+// /netconf-state/sessions of ietf-netconf-monitoring (RFC 6022).
+type SessionInfo struct {
+	SessionID uint64
+	// Transport is the transport identity without its prefix, such as
+	// netconf-ssh or netconf-tls.
+	Transport  string
+	Username   string
+	SourceHost string
+	// LoginTime is when the session was opened, the zero time if the
+	// server did not say.
+	LoginTime time.Time
+}
+
+// Sessions lists the sessions open on the server, this one included; its
+// session-id is SessionID. A session found to be stale can be ended with
+// KillSession.
+func (n *Ncclient) Sessions() ([]SessionInfo, error) {
+	return n.SessionsContext(context.Background())
+}
+
+// SessionsContext is like Sessions but gives up when ctx is done.
+func (n *Ncclient) SessionsContext(ctx context.Context) ([]SessionInfo, error) {
+	if err := n.requireCapability(CAPABILITY_MONITORING); err != nil {
+		return nil, err
+	}
+	reply, err := n.GetWithFilterContext(ctx, SubtreeFilter(fmt.Sprintf(`<netconf-state xmlns="%s"><sessions/></netconf-state>`, CAPABILITY_MONITORING)))
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Sessions []struct {
+			SessionID  string `xml:"session-id"`
+			Transport  string `xml:"transport"`
+			Username   string `xml:"username"`
+			SourceHost string `xml:"source-host"`
+			LoginTime  string `xml:"login-time"`
+		} `xml:"netconf-state>sessions>session"`
+	}
+	if err := xml.Unmarshal([]byte("<data>"+string(reply.Data())+"</data>"), &data); err != nil {
+		return nil, fmt.Errorf("invalid sessions: %w", err)
+	}
+	sessions := make([]SessionInfo, 0, len(data.Sessions))
+	for _, s := range data.Sessions {
+		id := strings.TrimSpace(s.SessionID)
+		session := SessionInfo{
+			Username:   strings.TrimSpace(s.Username),
+			SourceHost: strings.TrimSpace(s.SourceHost),
+		}
+		if session.SessionID, err = strconv.ParseUint(id, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid session-id %q: %w", id, err)
+		}
+		transport := strings.TrimSpace(s.Transport)
+		if _, identity, found := strings.Cut(transport, ":"); found {
+			transport = identity
+		}
+		session.Transport = transport
+		if login := strings.TrimSpace(s.LoginTime); login != "" {
+			if session.LoginTime, err = time.Parse(time.RFC3339Nano, login); err != nil {
+				return nil, fmt.Errorf("invalid login-time %q for session %d: %w", login, session.SessionID, err)
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
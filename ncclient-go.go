@@ -1,18 +1,28 @@
 package ncclient
 
 import (
-	"bufio"
 	"bytes"
 	"code.google.com/p/go.crypto/ssh"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
-	"runtime"
+	"net"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 const NETCONF_DELIM string = "]]>]]>"
+
+// NETCONF_PORT is the IANA assigned port for NETCONF over SSH (RFC 6242).
+const NETCONF_PORT int = 830
+
+// NETCONF_HELLO is the hello this package used to send. SendHello now
+// renders the hello from the client's capabilities; see DefaultCapabilities.
 const NETCONF_HELLO string = `
 <?xml version="1.0" encoding="UTF-8"?>
 <nc:hello xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0">
@@ -32,12 +42,105 @@ const NETCONF_HELLO string = `
 </nc:hello>
 `
 
+// ErrTimeout is returned when the server does not finish its reply within
+// the client's timeout.
+var ErrTimeout = errors.New("timed out waiting for NETCONF reply, most likely a bad NETCONF speaker")
+
+// ErrNoHello is returned by rpcs attempted before the hello exchange, which
+// servers require to complete before anything else.
+var ErrNoHello = errors.New("netconf hello exchange has not completed")
+
+// ErrSessionUnusable is returned by operations on a session that was torn
+// down after the connection was lost or an operation was cancelled or timed
+// out part way through; the client must Reconnect.
+var ErrSessionUnusable = errors.New("netconf session is unusable")
+
+// ErrConnectionClosed is returned when the server closes the connection
+// before sending a usable reply. It matches ErrSessionUnusable.
+var ErrConnectionClosed = fmt.Errorf("%w: connection closed by the server", ErrSessionUnusable)
+
+// ErrResponseTooLarge is returned when a message from the server exceeds
+// the size set with WithMaxResponseSize. The session is unusable afterwards.
+var ErrResponseTooLarge = errors.New("netconf response exceeds the maximum size")
+
+// ErrMalformedReply is matched by the *MalformedReplyError returned for a
+// reply that is not well-formed XML, when replies are checked; see
+// WithReplyValidation.
+var ErrMalformedReply = errors.New("netconf reply is not well-formed XML")
+
+// MalformedReplyError reports a reply that is not well-formed XML, often a
+// sign of the server's framing going wrong, such as a delimiter sent in
+// the middle of an element. It matches ErrMalformedReply.
+type MalformedReplyError struct {
+	// Reply is the reply as received, framing excluded.
+	Reply []byte
+	// Err is what the XML parser found wrong with it.
+	Err error
+}
+
+func (e *MalformedReplyError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrMalformedReply, e.Err)
+}
+
+func (e *MalformedReplyError) Is(target error) bool {
+	return target == ErrMalformedReply
+}
+
+func (e *MalformedReplyError) Unwrap() error {
+	return e.Err
+}
+
+// Connect failures are classified by these errors, which errors.Is
+// matches while errors.As still reaches the underlying error. Dial errors
+// may be worth retrying; authentication and host key failures are not.
+var (
+	// ErrDial means the server could not be reached.
+	ErrDial = errors.New("netconf dial failed")
+	// ErrAuth means the server rejected every authentication method.
+	ErrAuth = errors.New("netconf authentication failed")
+	// ErrHostKey means the server's host key or certificate was not trusted.
+	ErrHostKey = errors.New("netconf host key verification failed")
+	// ErrSubsystem means the server would not start NETCONF on the
+	// connection.
+	ErrSubsystem = errors.New("netconf subsystem unavailable")
+)
+
+// connectError classifies a Connect failure as one of ErrDial, ErrAuth,
+// ErrHostKey or ErrSubsystem and keeps the error it wraps.
+type connectError struct {
+	kind error
+	err  error
+}
+
+func (e *connectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *connectError) Unwrap() error {
+	return e.err
+}
+
+// ErrClosed is returned by operations on a client after Close, including
+// one that was waiting for its reply when Close was called.
+var ErrClosed = errors.New("netconf client is closed")
+
+// ErrNotConnected is returned by operations on a client that has not
+// connected yet.
+var ErrNotConnected = errors.New("netconf client is not connected")
+
 type clientPassword string
 
 func (p clientPassword) Password(user string) (string, error) {
 	return string(p), nil
 }
 
+// Ncclient is a NETCONF client. It is safe for concurrent use: operations
+// are serialized, so each request is written and its reply read before the
+// next request goes out on the wire.
 type Ncclient struct {
 	username string
 	password string
@@ -45,147 +148,735 @@ type Ncclient struct {
 	key      string
 	port     int
 	timeout  time.Duration
+	framing  framingMode
+
+	// connectTimeout bounds dialing, helloTimeout the hello exchange and
+	// rpcTimeout every later reply; timeout is used for any that is zero
+	connectTimeout time.Duration
+	helloTimeout   time.Duration
+	rpcTimeout     time.Duration
+
+	keyPassphrase   string
+	hostKeyCallback ssh.HostKeyCallback
+	useAgent        bool
+	sshAuth         []ssh.AuthMethod
+	sshConfig       ssh.Config
+	jumpHost        *ssh.Client
+	dialer          func(ctx context.Context, network, addr string) (net.Conn, error)
+	logger          LogFunc
+	// conn replaces dialing for the first Connect, see WithConn
+	conn     net.Conn
+	connUsed bool
+	// capture receives a copy of the raw traffic, if set
+	capture io.Writer
+
+	// keyboardInteractive answers keyboard-interactive prompts with the
+	// password
+	keyboardInteractive bool
+
+	keepaliveInterval  time.Duration
+	keepaliveMaxMissed int
+	xmlModeFallback    bool
+	// command is run in place of the netconf subsystem if set
+	command string
+	// synchronousReads reads replies in the calling goroutine
+	synchronousReads bool
+	// delimiterGrace accepts replies missing their delimiter, see
+	// WithMissingDelimiterFallback
+	delimiterGrace time.Duration
+	// maxResponseSize bounds each message from the server, if set
+	maxResponseSize int64
+
+	// clientCapabilities overrides DefaultCapabilities in our hello
+	clientCapabilities []string
+	// forceBase10 leaves base:1.1 out of our hello
+	forceBase10 bool
+	// rpcNamespace is the namespace of the <rpc> element, none if empty
+	rpcNamespace string
+	// defaultFilter is used by Get and GetConfig when given no filter
+	defaultFilter Filter
+	// validateReplies checks every reply is well-formed XML
+	validateReplies bool
+	// stripDeclarations drops XML declarations from reply data, see
+	// WithStripDataDeclarations
+	stripDeclarations bool
+
+	// serverHello is the server's hello, once the hello exchange is done
+	serverHello  []byte
+	capabilities []string
+	sessionID    uint64
+	messageID    uint64
+
+	// tlsConfig selects the TLS transport instead of SSH
+	tlsConfig *tls.Config
 
-	sshClient     *ssh.Client
-	session       *ssh.Session
-	sessionStdin  io.WriteCloser
-	sessionStdout io.Reader
+	// mu serializes operations on the session and guards its state. It is a
+	// pointer so that copies made by MakeClient share it.
+	mu        *sync.Mutex
+	transport Transport
+	reader    *sessionReader
+
+	// broken records why the session was abandoned, if it was
+	broken error
+	// closed is set by Close and CloseSession and cleared by Connect
+	closed bool
+
+	// closeMu guards closing, which Close closes to wake an operation
+	// waiting for its reply without first waiting for n.mu. reader is only
+	// set holding both mutexes, so either is enough to read it.
+	closeMu *sync.Mutex
+	closing chan struct{}
 }
 
-func (n Ncclient) Hostname() string {
+func (n *Ncclient) Hostname() string {
 	return n.hostname
 }
 
-func (n Ncclient) Close() {
-	n.session.Close()
-	n.sshClient.Close()
+// Clone returns a new, unconnected client for hostname with the same
+// settings as n, such as credentials, port, timeouts and capabilities, so
+// many devices can share one configuration. Nothing about n's session is
+// carried over; the clone has its own connection and message-ids. The
+// jump host and TLS config, if set, are shared rather than copied, and a
+// connection given with WithConn is not carried over.
+func (n *Ncclient) Clone(hostname string) *Ncclient {
+	n.mu.Lock()
+	clone := *n
+	n.mu.Unlock()
+
+	clone.hostname = hostname
+	clone.conn = nil
+	clone.connUsed = false
+	clone.framing = framingEOM
+	clone.serverHello = nil
+	clone.capabilities = nil
+	clone.sessionID = 0
+	clone.messageID = 0
+	clone.mu = new(sync.Mutex)
+	clone.transport = nil
+	clone.reader = nil
+	clone.broken = nil
+	clone.closed = false
+	clone.closeMu = new(sync.Mutex)
+	clone.closing = nil
+	return &clone
+}
+
+// Close ends the NETCONF session, asking the server to clean up with a
+// close-session first if the hello exchange has happened, and tears down
+// the transport. An operation waiting for its reply when Close is called
+// gives up at once with ErrClosed. Close is safe to call more than once,
+// after a failed Connect, before any Connect, and on a nil or zero
+// client.
+func (n *Ncclient) Close() {
+	// a zero Ncclient, not made by NewClient, cannot have been connected
+	if n == nil || n.mu == nil {
+		return
+	}
+	n.interrupt()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if n.broken == nil && n.serverHello != nil {
+		// the transport is torn down whether or not the server replies
+		n.writeRPCContext(context.Background(), []byte("<close-session/>"))
+	}
+	n.closeTransport()
+	n.closed = true
+}
+
+// Connected reports whether the client has a live session: Connect
+// succeeded, and since then the client has not been closed, the session
+// has not been found unusable and the server has not hung up. It does not
+// ask the server anything, so a server that has stopped answering without
+// closing the connection goes unnoticed until an operation times out; use
+// Ping or WithKeepalive for that. Connected waits for an operation in
+// progress to finish.
+func (n *Ncclient) Connected() bool {
+	if n.mu == nil {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connected()
+}
+
+// connected is Connected for callers already holding n.mu.
+func (n *Ncclient) connected() bool {
+	return !n.closed && n.transport != nil && n.serverHello != nil && n.broken == nil && !n.reader.stopped()
+}
+
+// interrupt wakes the operation waiting for its reply, if there is one.
+// Operations started afterwards are not affected.
+func (n *Ncclient) interrupt() {
+	n.closeMu.Lock()
+	defer n.closeMu.Unlock()
+	if n.closing != nil {
+		close(n.closing)
+		n.closing = nil
+	}
 }
 
-func (n Ncclient) SendHello() (io.Reader, error) {
-	reader, err := n.Write(NETCONF_HELLO)
-	return reader, err
+// closingChannel returns the channel interrupt closes, or nil once it has.
+func (n *Ncclient) closingChannel() <-chan struct{} {
+	n.closeMu.Lock()
+	defer n.closeMu.Unlock()
+	return n.closing
+}
+
+// closeTransport tears down the transport connection. The caller must hold
+// n.mu.
+func (n *Ncclient) closeTransport() {
+	n.serverHello = nil
+	n.sessionID = 0
+	if n.transport != nil {
+		n.transport.Close()
+	}
+}
+
+// SendHello exchanges hello messages with the server, records the
+// capabilities and session-id it advertised, and switches to chunked
+// framing if both sides advertise base:1.1. The client hello advertises
+// DefaultCapabilities unless configured otherwise. It returns the server's
+// hello.
+//
+// Both hellos are exchanged before any rpc, as RFC 6241 requires: SendHello
+// waits for the server's hello, for the timeout set by WithHelloTimeout or
+// else the client timeout, and rpcs fail with ErrNoHello until it has
+// arrived. Connect already exchanges hellos, so calling SendHello
+// afterwards just returns the server's hello again.
+func (n *Ncclient) SendHello() (io.Reader, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sendHello(context.Background())
+}
+
+// sendHello is SendHello for callers already holding n.mu, giving up when
+// ctx is done.
+func (n *Ncclient) sendHello(ctx context.Context) (io.Reader, error) {
+	if n.serverHello != nil {
+		return bytes.NewReader(n.serverHello), nil
+	}
+
+	local := n.localCapabilities()
+
+	// hellos are always end-of-message framed, whatever follows
+	n.setFraming(framingEOM)
+	clientHello, err := Hello{Capabilities: local}.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	// the rpc timeout does not apply to the hello, so give it a deadline
+	// of its own unless ctx has one
+	helloCtx := ctx
+	helloTimeout := n.helloTimeout
+	if _, ok := ctx.Deadline(); !ok && helloTimeout == 0 {
+		helloTimeout = n.timeout
+	}
+	if helloTimeout > 0 {
+		var cancel context.CancelFunc
+		helloCtx, cancel = context.WithTimeout(ctx, helloTimeout)
+		defer cancel()
+	}
+	reply, err := n.writeContext(helloCtx, clientHello)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w: no hello from the server within %v", ErrTimeout, helloTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hello, err := io.ReadAll(reply)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := ParseHello(hello)
+	if err != nil {
+		return nil, err
+	}
+	n.serverHello = hello
+	n.capabilities = remote.Capabilities
+	n.sessionID = remote.SessionID
+	n.setFraming(negotiateFraming(local, remote.Capabilities))
+	return bytes.NewReader(hello), nil
 }
 
+// WriteRPC wraps line in an <rpc> stamped with the next message-id, sends
+// it and checks that the reply echoes the same message-id.
 // TODO: use the xml module to add/remove rpc related tags
-func (n Ncclient) WriteRPC(line string) (io.Reader, error) {
-	line = fmt.Sprintf("<rpc>%s</rpc>", line)
-	return n.Write(line)
-}
-
-func (n Ncclient) Write(line string) (result io.Reader, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			err = errors.New(r.(string))
+func (n *Ncclient) WriteRPC(line string) (io.Reader, error) {
+	return n.WriteRPCContext(context.Background(), line)
+}
+
+// WriteRPCContext is like WriteRPC but gives up when ctx is done.
+func (n *Ncclient) WriteRPCContext(ctx context.Context, line string) (io.Reader, error) {
+	return n.WriteRPCBytesContext(ctx, []byte(line))
+}
+
+// WriteRPCBytes is like WriteRPC but takes the rpc as bytes, such as XML
+// built in a buffer with encoding/xml, and writes them to the session as
+// they are, without copying them into a string.
+func (n *Ncclient) WriteRPCBytes(line []byte) (io.Reader, error) {
+	return n.WriteRPCBytesContext(context.Background(), line)
+}
+
+// WriteRPCBytesContext is like WriteRPCBytes but gives up when ctx is done.
+func (n *Ncclient) WriteRPCBytesContext(ctx context.Context, line []byte) (io.Reader, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.writeRPCContext(ctx, line)
+}
+
+// writeRPCContext is WriteRPCBytesContext for callers already holding n.mu.
+func (n *Ncclient) writeRPCContext(ctx context.Context, line []byte) (io.Reader, error) {
+	if n.closed {
+		return nil, ErrClosed
+	}
+	if n.serverHello == nil {
+		return nil, ErrNoHello
+	}
+
+	messageID, rpc := n.wrapRPC(line)
+	return n.exchange(ctx, messageID, rpc...)
+}
+
+// wrapRPC wraps line in an <rpc> in the client's rpc namespace, stamped
+// with the next message-id, and returns the message-id and the parts of
+// the rpc, line itself among them.
+func (n *Ncclient) wrapRPC(line []byte) (string, [][]byte) {
+	n.messageID++
+	messageID := strconv.FormatUint(n.messageID, 10)
+	open := fmt.Sprintf(`<rpc message-id="%s">`, messageID)
+	if n.rpcNamespace != "" {
+		open = fmt.Sprintf(`<rpc xmlns="%s" message-id="%s">`, escapeText(n.rpcNamespace), messageID)
+	}
+	return messageID, [][]byte{[]byte(open), line, []byte("</rpc>")}
+}
+
+func (n *Ncclient) Write(line string) (io.Reader, error) {
+	return n.WriteContext(context.Background(), line)
+}
+
+// WriteBytes is like Write but takes the message as bytes, written to the
+// session as they are without copying them into a string.
+func (n *Ncclient) WriteBytes(line []byte) (io.Reader, error) {
+	return n.WriteBytesContext(context.Background(), line)
+}
+
+// WriteBytesContext is like WriteBytes but gives up when ctx is done; see
+// WriteContext.
+func (n *Ncclient) WriteBytesContext(ctx context.Context, line []byte) (io.Reader, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.writeContext(ctx, line)
+}
+
+// WriteContext is like Write but gives up when ctx is done. If ctx has a
+// deadline it replaces the client timeout for this call, so a slow bulk read
+// can be given minutes while other operations keep the client default:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+//	defer cancel()
+//	reply, err := client.GetConfigContext(ctx, "running", "")
+//
+// A reply that is abandoned part way through would desynchronise every
+// later read, so giving up closes the session and marks it unusable until
+// the next Connect.
+func (n *Ncclient) WriteContext(ctx context.Context, line string) (io.Reader, error) {
+	return n.WriteBytesContext(ctx, []byte(line))
+}
+
+// writeContext is WriteBytesContext for callers already holding n.mu,
+// sending the message made of parts.
+func (n *Ncclient) writeContext(ctx context.Context, parts ...[]byte) (io.Reader, error) {
+	return n.exchange(ctx, "", parts...)
+}
+
+// exchange sends the message made of parts and returns the reply. If
+// messageID is set the reply must carry it: replies to earlier rpcs, left
+// over from one that was given up on or sent unsolicited, are discarded,
+// and any other message-id leaves the session unusable, since every later
+// reply would be off by one.
+func (n *Ncclient) exchange(ctx context.Context, messageID string, parts ...[]byte) (io.Reader, error) {
+	if n.closed {
+		return nil, ErrClosed
+	}
+	if n.transport == nil {
+		return nil, ErrNotConnected
+	}
+	if n.broken != nil {
+		return nil, n.broken
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// the server may have hung up, or the transport been torn down, since
+	// the last reply
+	if n.reader.stopped() {
+		return nil, n.readFailed(ctx, n.reader.err)
+	}
+
+	timeoutCtx, cancel := n.operationContext(ctx)
+	defer cancel()
+	closing := n.closingChannel()
+
+	// a read deadline makes the blocked read itself give up at the deadline
+	deadline, _ := timeoutCtx.Deadline()
+	hasDeadline := n.setReadDeadline(deadline)
+	if hasDeadline {
+		defer n.setReadDeadline(time.Time{})
+	}
+
+	if err := n.send(parts...); err != nil {
+		return nil, n.readFailed(ctx, err)
+	}
+	for {
+		var reply *bytes.Buffer
+		var err error
+		if n.reader.synchronous {
+			reply, err = n.readReply(ctx, deadline, hasDeadline, closing)
+		} else {
+			reply, err = n.receiveReply(ctx, timeoutCtx, closing)
 		}
-	}()
+		if err != nil {
+			return nil, err
+		}
+		if err := n.checkReply(reply); err != nil {
+			// whatever follows a reply cut short is out of step with the
+			// framing, so no later reply can be trusted
+			n.abandon(err)
+			return nil, err
+		}
+		if messageID == "" {
+			return reply, nil
+		}
+		replyID, err := replyMessageID(reply.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if replyID == messageID {
+			return reply, nil
+		}
+		if !staleMessageID(replyID, messageID) {
+			err := fmt.Errorf("%w: sent %s, received %q", ErrMessageIDMismatch, messageID, replyID)
+			n.abandon(err)
+			return nil, err
+		}
+	}
+}
 
-	if _, err := io.WriteString(n.sessionStdin, line+NETCONF_DELIM); err != nil {
-		panic(err)
+// staleMessageID reports whether replyID is the message-id of an rpc sent
+// before the one with messageID.
+func staleMessageID(replyID, messageID string) bool {
+	reply, err := strconv.ParseUint(replyID, 10, 64)
+	if err != nil {
+		return false
 	}
+	sent, err := strconv.ParseUint(messageID, 10, 64)
+	return err == nil && reply < sent
+}
 
-	finished := make(chan *bytes.Buffer, 1)
+// receiveReply waits for the session reader to hand over the next reply.
+func (n *Ncclient) receiveReply(ctx, timeoutCtx context.Context, closing <-chan struct{}) (*bytes.Buffer, error) {
+	select {
+	case result, ok := <-n.reader.messages:
+		if !ok {
+			return nil, n.readFailed(ctx, n.reader.err)
+		}
+		n.log(LogReceive, result.String())
+		return result, nil
+	case <-timeoutCtx.Done():
+		return nil, n.timedOut(ctx)
+	case <-closing:
+		n.abandon(ErrClosed)
+		return nil, ErrClosed
+	}
+}
 
+// readReply reads the reply in the calling goroutine, for a synchronous
+// reader. Unless the transport has a read deadline set, it is closed once
+// deadline passes, failing the read. It is also closed when closing is
+// closed by Close, so the read fails at once with ErrClosed. Cancelling
+// ctx without a deadline takes effect only when the read returns.
+func (n *Ncclient) readReply(ctx context.Context, deadline time.Time, hasDeadline bool, closing <-chan struct{}) (*bytes.Buffer, error) {
+	transport := n.transport
+	if !hasDeadline {
+		timer := time.AfterFunc(time.Until(deadline), func() { transport.Close() })
+		defer timer.Stop()
+	}
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		xmlBuffer := bytes.NewBufferString("")
-		scanner := bufio.NewScanner(n.sessionStdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == NETCONF_DELIM {
-				finished <- xmlBuffer
-				break
-			}
-			xmlBuffer.WriteString(line + "\n")
+		select {
+		case <-closing:
+			transport.Close()
+		case <-done:
 		}
 	}()
 
-	select {
-	case result := <-finished:
-		return result, err
-	case <-time.After(n.timeout):
-		panic("Timed out waiting for NETCONF DELIMITER! Most likely a bad NETCONF speaker.")
+	result, err := n.reader.next(n)
+	if err != nil {
+		select {
+		case <-closing:
+			n.abandon(ErrClosed)
+			return nil, ErrClosed
+		default:
+		}
+		if !time.Now().Before(deadline) {
+			return nil, n.timedOut(ctx)
+		}
+		return nil, n.readFailed(ctx, err)
+	}
+	n.log(LogReceive, result.String())
+	return result, nil
+}
+
+// checkReply returns a *MalformedReplyError if replies are checked and
+// reply is not well-formed XML.
+func (n *Ncclient) checkReply(reply *bytes.Buffer) error {
+	if !n.validateReplies {
+		return nil
+	}
+	if err := wellFormed(reply.Bytes()); err != nil {
+		return &MalformedReplyError{Reply: reply.Bytes(), Err: err}
+	}
+	return nil
+}
+
+// operationContext returns ctx limited by the rpc timeout, unless ctx
+// already has a deadline of its own.
+func (n *Ncclient) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, n.replyTimeout())
+}
+
+// send frames and writes the message made of parts.
+func (n *Ncclient) send(parts ...[]byte) error {
+	message := encodeMessage(n.currentFraming(), parts...)
+	if n.logger != nil {
+		n.log(LogSend, string(bytes.Join(message, nil)))
 	}
+	_, err := message.WriteTo(n.transport)
+	return err
 }
 
-func MakeSshClient(username string, password string, hostname string, key string, port int) (*ssh.Client, *ssh.Session, io.WriteCloser, io.Reader) {
+// readFailed abandons the session after reading the reply, or writing the
+// rpc, failed with err and returns the error to report.
+func (n *Ncclient) readFailed(ctx context.Context, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n.timedOut(ctx)
+	}
+	if isEOF(err) {
+		n.broken = ErrConnectionClosed
+		n.transport.Close()
+		return ErrConnectionClosed
+	}
+	// the connection is gone, so every later operation would fail too
+	n.abandon(err)
+	if errors.Is(err, ErrResponseTooLarge) {
+		return err
+	}
+	return n.broken
+}
 
-	var config *ssh.ClientConfig
+// timedOut abandons the session after an operation ran out of time and
+// returns the error to report: the context's error if ctx ended, otherwise
+// ErrTimeout.
+func (n *Ncclient) timedOut(ctx context.Context) error {
+	err := ctx.Err()
+	if deadline, ok := ctx.Deadline(); ok && err == nil && !time.Now().Before(deadline) {
+		// a read deadline set from ctx may fire before ctx itself ends
+		err = context.DeadlineExceeded
+	}
+	if err == nil {
+		err = ErrTimeout
+	}
+	n.abandon(err)
+	return err
+}
 
-	if key != "" {
-		signer, _ := ssh.ParsePrivateKey([]byte(key))
+// abandon closes the transport so the session reader, which may be part way
+// through the abandoned reply, unblocks and exits, and makes later
+// operations fail fast.
+func (n *Ncclient) abandon(cause error) {
+	n.broken = fmt.Errorf("%w: %v", ErrSessionUnusable, cause)
+	n.transport.Close()
+}
+
+// MakeSshClient dials hostname and opens the SSH session a NETCONF client
+// runs over, returning the session's stdin and stdout.
+func MakeSshClient(username string, password string, hostname string, key string, port int, hostKeyCallback ssh.HostKeyCallback) (*ssh.Client, *ssh.Session, io.WriteCloser, io.Reader, error) {
+	nc := MakeClientWithHostKeyCallback(username, password, hostname, key, port, hostKeyCallback)
+	return nc.dialSSH(context.Background())
+}
+
+// dialSSH dials the client's host and opens an SSH session.
+func (n *Ncclient) dialSSH(ctx context.Context) (*ssh.Client, *ssh.Session, io.WriteCloser, io.Reader, error) {
+	hostname := n.hostname
+
+	hostKeyCallback := n.hostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = rejectHostKey
+	}
+	// the handshake error does not say whether the host key was at fault
+	hostKeyRejected := false
+	checkHostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeyCallback(hostname, remote, key)
+		hostKeyRejected = err != nil
+		return err
+	}
+
+	auth, authCloser, err := n.authMethods()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer authCloser.Close()
+
+	config := &ssh.ClientConfig{
+		Config:          n.sshConfig,
+		User:            n.username,
+		Auth:            auth,
+		HostKeyCallback: checkHostKey,
+	}
 
-		config = &ssh.ClientConfig{
-			User: username,
-			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
-				ssh.Password(password),
-			},
+	conn, err := n.dialConn(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to dial %s: %w", hostname, ctx.Err())
 		}
-	} else {
-		config = &ssh.ClientConfig{
-			User: username,
-			Auth: []ssh.AuthMethod{
-				ssh.Password(password),
-			},
+		return nil, nil, nil, nil, &connectError{ErrDial, fmt.Errorf("failed to dial %s: %w", hostname, err)}
+	}
+	// closing the connection aborts the handshake and the session request
+	// if ctx is done first
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	// bound the handshake too; connections through a jump host may not
+	// support deadlines
+	conn.SetDeadline(time.Now().Add(n.dialTimeout()))
+	c, chans, reqs, err := ssh.NewClientConn(conn, n.dialAddress(), config)
+	if err != nil {
+		stop()
+		conn.Close()
+		err = fmt.Errorf("failed to dial %s: %w", hostname, err)
+		switch {
+		case ctx.Err() != nil:
+			err = fmt.Errorf("failed to dial %s: %w", hostname, ctx.Err())
+		case hostKeyRejected:
+			err = &connectError{ErrHostKey, err}
+		case strings.Contains(err.Error(), "unable to authenticate"):
+			err = &connectError{ErrAuth, err}
 		}
+		return nil, nil, nil, nil, err
 	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
 
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%s", hostname, strconv.Itoa(port)), config)
+	session, stdin, stdout, err := openSession(client)
+	if !stop() {
+		// ctx is done and the connection closed
+		client.Close()
+		return nil, nil, nil, nil, fmt.Errorf("failed to dial %s: %w", hostname, ctx.Err())
+	}
 	if err != nil {
-		panic("Failed to dial:" + hostname + err.Error())
+		client.Close()
+		return nil, nil, nil, nil, err
 	}
+	return client, session, stdin, stdout, nil
+}
 
+// openSession opens a new SSH session on client and its stdin and stdout.
+func openSession(client *ssh.Client) (*ssh.Session, io.WriteCloser, io.Reader, error) {
 	session, err := client.NewSession()
 	if err != nil {
-		panic("Failed to create session: " + err.Error())
+		return nil, nil, nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	stdin, err := session.StdinPipe()
 	if err != nil {
-		panic(err)
+		session.Close()
+		return nil, nil, nil, err
 	}
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
-		panic(err)
+		session.Close()
+		return nil, nil, nil, err
 	}
-	return client, session, stdin, stdout
+	return session, stdin, stdout, nil
 }
 
-func (n *Ncclient) Connect() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			err = errors.New(r.(string))
-		}
-	}()
-	sshClient, sshSession, sessionStdin, sessionStdout := MakeSshClient(n.username, n.password, n.hostname, n.key, n.port)
-
-	if err := sshSession.RequestSubsystem("netconf"); err != nil {
-		// TODO: the command `xml-mode netconf need-trailer` can be executed
-		// as a  backup if the netconf subsystem is not available, try that if we fail
-		sshClient.Close()
-		sshSession.Close()
-		panic("Failed to make subsystem request: " + err.Error())
-	}
-	n.sshClient = sshClient
-	n.session = sshSession
-	n.sessionStdin = sessionStdin
-	n.sessionStdout = sessionStdout
-	return err
+// Connect establishes the transport to the server, NETCONF over SSH unless
+// the client was configured to use TLS, and exchanges hellos so the session
+// is ready for rpcs. A session left from an earlier Connect is torn down
+// first.
+func (n *Ncclient) Connect() error {
+	return n.ConnectContext(context.Background())
 }
 
+// ConnectContext is like Connect but gives up when ctx is done, at any
+// stage from dialing to the hello exchange, closing whatever had been
+// established so far. A deadline on ctx replaces the client timeout for
+// the hello exchange but does not lengthen the connect timeout.
+func (n *Ncclient) ConnectContext(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.closeTransport()
+
+	var transport Transport
+	var err error
+	if n.tlsConfig != nil {
+		transport, err = n.dialTLS(ctx)
+	} else {
+		transport, err = n.dialSSHTransport(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if n.capture != nil {
+		transport = &captureTransport{Transport: transport, w: n.capture}
+	}
+
+	n.transport = transport
+	n.broken = nil
+	n.closed = false
+	n.closeMu.Lock()
+	n.reader = startSessionReader(n, transport)
+	n.closing = make(chan struct{})
+	n.closeMu.Unlock()
+	n.serverHello = nil
+
+	if _, err := n.sendHello(ctx); err != nil {
+		n.closeTransport()
+		return fmt.Errorf("hello exchange failed: %w", err)
+	}
+	return nil
+}
+
+// MakeClient returns a client using password and, when key is non-empty,
+// public key authentication. A port of 0 selects NETCONF_PORT, 830; pass 22
+// for devices that serve netconf on the SSH port. See NewClient for more
+// options.
 func MakeClient(username string, password string, hostname string, key string, port int) Ncclient {
-	nc := new(Ncclient)
-	nc.username = username
-	nc.password = password
-	nc.hostname = hostname
-	nc.key = key
-	nc.port = port
-	nc.timeout = time.Second * 30
+	return MakeClientWithHostKeyCallback(username, password, hostname, key, port, nil)
+}
+
+// MakeClientWithHostKeyCallback is like MakeClient but verifies the server's
+// host key with hostKeyCallback, for example one returned by KnownHosts.
+// Clients made by MakeClient reject every host key unless a callback is set.
+func MakeClientWithHostKeyCallback(username string, password string, hostname string, key string, port int, hostKeyCallback ssh.HostKeyCallback) Ncclient {
+	// none of these options can fail
+	nc, _ := NewClient(hostname,
+		WithUsername(username),
+		WithPassword(password),
+		WithKey(key),
+		WithPort(port),
+		WithHostKeyCallback(hostKeyCallback),
+	)
 	return *nc
 }
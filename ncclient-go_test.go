@@ -0,0 +1,321 @@
+package ncclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeServer is the server end of a session run over net.Pipe, for tests
+// that need to script exactly what the server sends.
+type pipeServer struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// read returns the next message from the client.
+func (s *pipeServer) read() (string, error) {
+	var msg bytes.Buffer
+	if err := skipSpace(s.r); err != nil {
+		return "", err
+	}
+	if err := readEOMMessage(s.r, &msg); err != nil {
+		return "", err
+	}
+	return msg.String(), nil
+}
+
+// reply reads the next rpc and answers it with content, echoing its
+// message-id.
+func (s *pipeServer) reply(content string) error {
+	req, err := s.read()
+	if err != nil {
+		return err
+	}
+	root, err := rootElement([]byte(req))
+	if err != nil {
+		return err
+	}
+	return s.write(replyWithID(attrValue(root.Attr, "message-id"), content))
+}
+
+// write sends msg with end-of-message framing.
+func (s *pipeServer) write(msg string) error {
+	_, err := io.WriteString(s.conn, msg+NETCONF_DELIM)
+	return err
+}
+
+func replyWithID(messageID, content string) string {
+	return fmt.Sprintf(`<rpc-reply xmlns="%s" message-id="%s">%s</rpc-reply>`, NETCONF_NAMESPACE, messageID, content)
+}
+
+// connectPipe returns a client that has exchanged hellos with a server
+// over net.Pipe, which serve then scripts in a goroutine of its own.
+func connectPipe(t *testing.T, serve func(s *pipeServer), opts ...Option) *Ncclient {
+	t.Helper()
+	return connectPipeWithHello(t, fakeServerHello(1), serve, opts...)
+}
+
+// connectPipeWithHello is like connectPipe but the server sends hello.
+func connectPipeWithHello(t *testing.T, hello string, serve func(s *pipeServer), opts ...Option) *Ncclient {
+	t.Helper()
+	client, server := pipeClient(t, opts...)
+	go func() {
+		if _, err := server.read(); err != nil {
+			return
+		}
+		if err := server.write(hello); err != nil {
+			return
+		}
+		serve(server)
+	}()
+	if _, err := client.SendHello(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// pipeClient returns a client and the server end of a net.Pipe, before
+// any hello has been exchanged.
+func pipeClient(t *testing.T, opts ...Option) (*Ncclient, *pipeServer) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	client, err := NewClient("pipe", append([]Option{WithTimeout(5 * time.Second)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.transport = clientConn
+	client.reader = startSessionReader(client, clientConn)
+	client.closing = make(chan struct{})
+	t.Cleanup(func() { client.Close() })
+	// closing the server end first keeps Close from waiting on a server
+	// that is no longer reading
+	t.Cleanup(func() { serverConn.Close() })
+	return client, &pipeServer{conn: serverConn, r: bufio.NewReader(serverConn)}
+}
+
+func TestStaleReplyDiscarded(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		if _, err := s.read(); err != nil {
+			return
+		}
+		// a reply to an earlier rpc arrives before the real one
+		s.write(replyWithID("0", "<ok/>"))
+		s.write(replyWithID("1", "<data><a/></data>"))
+		s.reply("<ok/>")
+	})
+
+	reply, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reply.Data()); got != "<a/>" {
+		t.Errorf("Data() = %q, want the reply to the rpc sent", got)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("the next rpc failed: %v", err)
+	}
+}
+
+func TestUnexpectedMessageID(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		if _, err := s.read(); err != nil {
+			return
+		}
+		s.write(replyWithID("7", "<ok/>"))
+	})
+
+	if _, err := client.Get(""); !errors.Is(err, ErrMessageIDMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrMessageIDMismatch)
+	}
+	if client.Connected() {
+		t.Error("Connected() after a reply with an unexpected message-id")
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Errorf("got %v, want %v", err, ErrSessionUnusable)
+	}
+}
+
+func TestServerHungUpAfterReply(t *testing.T) {
+	for _, synchronous := range []bool{false, true} {
+		var opts []Option
+		if synchronous {
+			opts = append(opts, WithSynchronousReads())
+		}
+		hungUp := make(chan struct{})
+		client := connectPipe(t, func(s *pipeServer) {
+			s.reply("<ok/>")
+			s.conn.Close()
+			close(hungUp)
+		}, opts...)
+
+		if _, err := client.Get(""); err != nil {
+			t.Fatalf("synchronous %v: %v", synchronous, err)
+		}
+		<-hungUp
+		for i := 0; i < 2; i++ {
+			if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+				t.Errorf("synchronous %v: got %v, want %v", synchronous, err, ErrSessionUnusable)
+			}
+		}
+	}
+}
+
+func TestMalformedReplyAbandonsSession(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		if _, err := s.read(); err != nil {
+			return
+		}
+		// the delimiter appears in the middle of the reply
+		s.write(`<rpc-reply xmlns="` + NETCONF_NAMESPACE + `" message-id="1"><data>`)
+		s.write(`</data></rpc-reply>`)
+	}, WithReplyValidation())
+
+	_, err := client.Get("")
+	var malformed *MalformedReplyError
+	if !errors.As(err, &malformed) || !errors.Is(err, ErrMalformedReply) {
+		t.Fatalf("got %v, want a *MalformedReplyError", err)
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Errorf("got %v, want %v", err, ErrSessionUnusable)
+	}
+}
+
+func TestCloseUnconnected(t *testing.T) {
+	var zero Ncclient
+	zero.Close()
+	zero.Close()
+	if zero.Connected() {
+		t.Error("a zero client reports being connected")
+	}
+
+	var nilClient *Ncclient
+	nilClient.Close()
+
+	client, err := NewClient("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	client.Close()
+	if _, err := client.Get(""); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestConnectTwiceClosesFirstSession(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" })
+	client.mu.Lock()
+	first := client.dialedTransport().(*sshTransport)
+	client.mu.Unlock()
+
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-first.done:
+	default:
+		t.Error("the first session was left open")
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("Get on the second session: %v", err)
+	}
+}
+
+func TestMissingDelimiterFallback(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		for {
+			req, err := s.read()
+			if err != nil {
+				return
+			}
+			root, err := rootElement([]byte(req))
+			if err != nil {
+				return
+			}
+			// the reply never gets its delimiter
+			io.WriteString(s.conn, replyWithID(attrValue(root.Attr, "message-id"), "<ok/>"))
+		}
+	}, WithMissingDelimiterFallback(20*time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(""); err != nil {
+			t.Fatalf("rpc %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestContextDeadlineReplacesTimeout(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		for {
+			if _, err := s.read(); err != nil {
+				return
+			}
+		}
+	}, WithRPCTimeout(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetContext(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	client := connectPipe(t, func(s *pipeServer) {
+		// rpcs are read but never answered
+		for {
+			if _, err := s.read(); err != nil {
+				return
+			}
+		}
+	}, WithRPCTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	if _, err := client.Get(""); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the rpc timed out after %v", elapsed)
+	}
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Errorf("got %v, want %v", err, ErrSessionUnusable)
+	}
+}
+
+func TestHelloTimeout(t *testing.T) {
+	client, server := pipeClient(t, WithTimeout(time.Hour), WithHelloTimeout(50*time.Millisecond))
+	// the server reads the client's hello but never sends its own
+	go io.Copy(io.Discard, server.conn)
+
+	if _, err := client.SendHello(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestRPCTimeoutSkipsHello(t *testing.T) {
+	client, server := pipeClient(t, WithRPCTimeout(50*time.Millisecond), WithHelloTimeout(5*time.Second))
+	go func() {
+		if _, err := server.read(); err != nil {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		if err := server.write(fakeServerHello(1)); err != nil {
+			return
+		}
+		server.reply("<data/>")
+	}()
+
+	if _, err := client.SendHello(); err != nil {
+		t.Fatalf("a hello slower than the rpc timeout failed: %v", err)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+}
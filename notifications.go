@@ -0,0 +1,160 @@
+package ncclient
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Notification is an event notification sent by the server after
+// CreateSubscription (RFC 5277).
+type Notification struct {
+	// EventTime is when the event was generated.
+	EventTime time.Time
+	// InnerXML holds everything inside the <notification>, including the
+	// event content and the <eventTime> element.
+	InnerXML []byte
+}
+
+func parseNotification(data []byte) (*Notification, error) {
+	var msg struct {
+		EventTime string `xml:"eventTime"`
+		InnerXML  []byte `xml:",innerxml"`
+	}
+	if err := xml.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	eventTime, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(msg.EventTime))
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification eventTime %q: %w", msg.EventTime, err)
+	}
+	return &Notification{EventTime: eventTime, InnerXML: msg.InnerXML}, nil
+}
+
+// Notifications returns the channel notifications for this session are
+// delivered on. It is closed when the session ends. Once its buffer is full
+// the session waits for notifications to be received before reading any
+// further replies, so subscribers must keep draining it or call
+// StopNotifications.
+func (n *Ncclient) Notifications() <-chan *Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.reader == nil {
+		return nil
+	}
+	return n.reader.notifications
+}
+
+// StopNotifications stops delivering notifications for this session and
+// closes the Notifications channel; notifications already buffered can
+// still be received from it. Replies keep flowing as before. RFC 5277 has
+// no way to end a subscription, so the server carries on sending
+// notifications, which are read and dropped, until the session ends or
+// the stopTime given to CreateSubscription passes. A new session after
+// Reconnect delivers notifications again.
+func (n *Ncclient) StopNotifications() {
+	// n.mu may be held by an operation whose reply is queued behind
+	// notifications nobody receives, so it is not waited for
+	n.closeMu.Lock()
+	reader := n.reader
+	n.closeMu.Unlock()
+	if reader != nil {
+		reader.stopNotify()
+	}
+}
+
+// CreateSubscription subscribes to event notifications, which are then
+// delivered on Notifications. An empty stream subscribes to the default
+// NETCONF stream. Zero startTime and stopTime are left out: a startTime
+// replays events from the stream's log, and a stopTime ends the
+// subscription. A non-empty filter is sent as a subtree filter.
+func (n *Ncclient) CreateSubscription(stream string, startTime, stopTime time.Time, filter string) (*RPCReply, error) {
+	return n.CreateSubscriptionContext(context.Background(), stream, startTime, stopTime, filter)
+}
+
+// CreateSubscriptionContext is like CreateSubscription but gives up when ctx
+// is done.
+func (n *Ncclient) CreateSubscriptionContext(ctx context.Context, stream string, startTime, stopTime time.Time, filter string) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_NOTIFICATION); err != nil {
+		return nil, err
+	}
+	if !stopTime.IsZero() && startTime.IsZero() {
+		return nil, fmt.Errorf("stopTime requires a startTime")
+	}
+	filterElement, err := SubtreeFilter(filter).render(n)
+	if err != nil {
+		return nil, err
+	}
+
+	rpc := `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">`
+	if stream != "" {
+		rpc += fmt.Sprintf("<stream>%s</stream>", escapeText(stream))
+	}
+	rpc += filterElement
+	if !startTime.IsZero() {
+		rpc += fmt.Sprintf("<startTime>%s</startTime>", startTime.Format(time.RFC3339Nano))
+	}
+	if !stopTime.IsZero() {
+		rpc += fmt.Sprintf("<stopTime>%s</stopTime>", stopTime.Format(time.RFC3339Nano))
+	}
+	rpc += "</create-subscription>"
+	return n.rpc(ctx, rpc)
+}
+
+// Stream is an event stream a server offers for CreateSubscription.
+type Stream struct {
+	Name        string
+	Description string
+	// ReplaySupport reports whether the stream can replay logged events
+	// to a subscription with a startTime.
+	ReplaySupport bool
+	// ReplayLogCreationTime is when the replay log started, the zero time
+	// if the server did not say.
+	ReplayLogCreationTime time.Time
+}
+
+// Streams lists the event streams the server offers, such as NETCONF or
+// syslog, read from the /netconf/streams list of RFC 5277 with a get.
+func (n *Ncclient) Streams() ([]Stream, error) {
+	return n.StreamsContext(context.Background())
+}
+
+// StreamsContext is like Streams but gives up when ctx is done.
+func (n *Ncclient) StreamsContext(ctx context.Context) ([]Stream, error) {
+	if err := n.requireCapability(CAPABILITY_NOTIFICATION); err != nil {
+		return nil, err
+	}
+	reply, err := n.GetWithFilterContext(ctx, SubtreeFilter(`<netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams/></netconf>`))
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Streams []struct {
+			Name                  string `xml:"name"`
+			Description           string `xml:"description"`
+			ReplaySupport         bool   `xml:"replaySupport"`
+			ReplayLogCreationTime string `xml:"replayLogCreationTime"`
+		} `xml:"netconf>streams>stream"`
+	}
+	if err := xml.Unmarshal([]byte("<data>"+string(reply.Data())+"</data>"), &data); err != nil {
+		return nil, fmt.Errorf("invalid streams: %w", err)
+	}
+	streams := make([]Stream, 0, len(data.Streams))
+	for _, s := range data.Streams {
+		stream := Stream{
+			Name:          strings.TrimSpace(s.Name),
+			Description:   strings.TrimSpace(s.Description),
+			ReplaySupport: s.ReplaySupport,
+		}
+		if created := strings.TrimSpace(s.ReplayLogCreationTime); created != "" {
+			if stream.ReplayLogCreationTime, err = time.Parse(time.RFC3339Nano, created); err != nil {
+				return nil, fmt.Errorf("invalid replayLogCreationTime %q for stream %q: %w", created, stream.Name, err)
+			}
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
@@ -0,0 +1,127 @@
+package ncclient
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notificationHello is the hello of a server supporting notifications.
+func notificationHello(t *testing.T) string {
+	t.Helper()
+	hello, err := Hello{SessionID: 1, Capabilities: []string{NETCONF_BASE_10, CAPABILITY_NOTIFICATION, "urn:ietf:params:netconf:capability:interleave:1.0"}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hello)
+}
+
+func notification(eventTime string) string {
+	return `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>` + eventTime + `</eventTime><link-down xmlns="urn:x"/></notification>`
+}
+
+func TestNotifications(t *testing.T) {
+	requests := make(chan string, 1)
+	client := connectPipeWithHello(t, notificationHello(t), func(s *pipeServer) {
+		req, err := s.read()
+		if err != nil {
+			return
+		}
+		requests <- req
+		s.write(replyWithID("1", "<ok/>"))
+		// a notification arrives while the next rpc waits for its reply
+		if _, err := s.read(); err != nil {
+			return
+		}
+		s.write(notification("2026-01-02T03:04:05Z"))
+		s.write(replyWithID("2", "<data/>"))
+	})
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := client.CreateSubscription("NETCONF", start, time.Time{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	for _, want := range []string{"<stream>NETCONF</stream>", "<startTime>2026-01-01T00:00:00Z</startTime>"} {
+		if !strings.Contains(req, want) {
+			t.Errorf("create-subscription %s does not contain %s", req, want)
+		}
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-client.Notifications():
+		if want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC); !got.EventTime.Equal(want) {
+			t.Errorf("EventTime = %v, want %v", got.EventTime, want)
+		}
+		if !strings.Contains(string(got.InnerXML), `<link-down xmlns="urn:x"/>`) {
+			t.Errorf("InnerXML = %s", got.InnerXML)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification delivered")
+	}
+}
+
+func TestCreateSubscriptionUnsupported(t *testing.T) {
+	client := connectPipe(t, func(*pipeServer) {})
+	if _, err := client.CreateSubscription("", time.Time{}, time.Time{}, ""); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedCapability)
+	}
+}
+
+func TestStopNotifications(t *testing.T) {
+	client := connectPipeWithHello(t, notificationHello(t), func(s *pipeServer) {
+		if err := s.reply("<ok/>"); err != nil {
+			return
+		}
+		// far more notifications than the channel buffers come before the
+		// reply, and nobody is receiving them
+		req, err := s.read()
+		if err != nil {
+			return
+		}
+		for i := 0; i < 2*notificationBuffer; i++ {
+			if err := s.write(notification("2026-01-02T03:04:05Z")); err != nil {
+				return
+			}
+		}
+		root, err := rootElement([]byte(req))
+		if err != nil {
+			return
+		}
+		s.write(replyWithID(attrValue(root.Attr, "message-id"), "<data/>"))
+	})
+	if _, err := client.CreateSubscription("", time.Time{}, time.Time{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Get("")
+		done <- err
+	}()
+	notifications := client.Notifications()
+	for len(notifications) < notificationBuffer {
+		time.Sleep(time.Millisecond)
+	}
+	client.StopNotifications()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reply was not read after StopNotifications")
+	}
+	received := 0
+	for range notifications {
+		received++
+	}
+	if received != notificationBuffer {
+		t.Errorf("received %d notifications, want the %d buffered", received, notificationBuffer)
+	}
+}
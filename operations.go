@@ -0,0 +1,881 @@
+package ncclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// datastoreElement returns the empty element naming a configuration
+// datastore, e.g. "<running/>" for "running".
+func datastoreElement(name string) (string, error) {
+	switch name {
+	case "running", "candidate", "startup":
+		return fmt.Sprintf("<%s/>", name), nil
+	}
+	return "", fmt.Errorf("invalid datastore %q: must be running, candidate or startup", name)
+}
+
+// datastoreCapability maps each datastore to the capability that makes it
+// writable.
+var datastoreCapability = map[string]string{
+	"running":   CAPABILITY_WRITABLE_RUNNING,
+	"candidate": CAPABILITY_CANDIDATE,
+	"startup":   CAPABILITY_STARTUP,
+}
+
+// GetConfig retrieves all or part of the source datastore. When filter is
+// non-empty it is sent as a subtree filter, otherwise the whole datastore
+// is returned, or the part the client's default filter selects; see
+// WithDefaultFilter. The data is in the reply's InnerXML.
+func (n *Ncclient) GetConfig(source string, filter string) (*RPCReply, error) {
+	return n.GetConfigWithFilterContext(context.Background(), source, SubtreeFilter(filter))
+}
+
+// GetConfigContext is like GetConfig but gives up when ctx is done.
+func (n *Ncclient) GetConfigContext(ctx context.Context, source string, filter string) (*RPCReply, error) {
+	return n.GetConfigWithFilterContext(ctx, source, SubtreeFilter(filter))
+}
+
+// GetConfigWithFilter is like GetConfig but takes a subtree or xpath Filter.
+func (n *Ncclient) GetConfigWithFilter(source string, filter Filter) (*RPCReply, error) {
+	return n.GetConfigWithFilterContext(context.Background(), source, filter)
+}
+
+// GetConfigWithFilterContext is like GetConfigWithFilter but gives up when
+// ctx is done.
+func (n *Ncclient) GetConfigWithFilterContext(ctx context.Context, source string, filter Filter) (*RPCReply, error) {
+	return n.GetConfigWithDefaultsContext(ctx, source, filter, "")
+}
+
+// GetConfigWithDefaults is like GetConfigWithFilter but asks the server to
+// report default values according to mode, one of the RFC 6243 modes
+// "report-all", "report-all-tagged", "trim" or "explicit". An empty mode
+// leaves the choice to the server. The server must advertise the
+// with-defaults capability.
+func (n *Ncclient) GetConfigWithDefaults(source string, filter Filter, mode string) (*RPCReply, error) {
+	return n.GetConfigWithDefaultsContext(context.Background(), source, filter, mode)
+}
+
+// GetConfigWithDefaultsContext is like GetConfigWithDefaults but gives up
+// when ctx is done.
+func (n *Ncclient) GetConfigWithDefaultsContext(ctx context.Context, source string, filter Filter, mode string) (*RPCReply, error) {
+	datastore, err := datastoreElement(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.requireDatastore(source, false); err != nil {
+		return nil, err
+	}
+	filterElement, err := filter.orDefault(n).render(n)
+	if err != nil {
+		return nil, err
+	}
+	withDefaults, err := n.withDefaultsElement(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.rpc(ctx, fmt.Sprintf("<get-config><source>%s</source>%s%s</get-config>", datastore, filterElement, withDefaults))
+}
+
+// Get retrieves running configuration and state data. When filter is
+// non-empty it is sent as a subtree filter, otherwise everything is
+// returned, or the part the client's default filter selects; see
+// WithDefaultFilter. The data is in the reply's InnerXML.
+func (n *Ncclient) Get(filter string) (*RPCReply, error) {
+	return n.GetWithFilterContext(context.Background(), SubtreeFilter(filter))
+}
+
+// GetContext is like Get but gives up when ctx is done.
+func (n *Ncclient) GetContext(ctx context.Context, filter string) (*RPCReply, error) {
+	return n.GetWithFilterContext(ctx, SubtreeFilter(filter))
+}
+
+// GetWithFilter is like Get but takes a subtree or xpath Filter.
+func (n *Ncclient) GetWithFilter(filter Filter) (*RPCReply, error) {
+	return n.GetWithFilterContext(context.Background(), filter)
+}
+
+// GetWithFilterContext is like GetWithFilter but gives up when ctx is done.
+func (n *Ncclient) GetWithFilterContext(ctx context.Context, filter Filter) (*RPCReply, error) {
+	return n.GetWithDefaultsContext(ctx, filter, "")
+}
+
+// GetWithDefaults is like GetWithFilter but asks the server to report
+// default values according to mode; see GetConfigWithDefaults.
+func (n *Ncclient) GetWithDefaults(filter Filter, mode string) (*RPCReply, error) {
+	return n.GetWithDefaultsContext(context.Background(), filter, mode)
+}
+
+// GetWithDefaultsContext is like GetWithDefaults but gives up when ctx is
+// done.
+func (n *Ncclient) GetWithDefaultsContext(ctx context.Context, filter Filter, mode string) (*RPCReply, error) {
+	filterElement, err := filter.orDefault(n).render(n)
+	if err != nil {
+		return nil, err
+	}
+	withDefaults, err := n.withDefaultsElement(mode)
+	if err != nil {
+		return nil, err
+	}
+	if filterElement == "" && withDefaults == "" {
+		return n.rpc(ctx, "<get/>")
+	}
+	return n.rpc(ctx, fmt.Sprintf("<get>%s%s</get>", filterElement, withDefaults))
+}
+
+// withDefaultsElement returns the <with-defaults> parameter for mode, or
+// nothing for an empty mode.
+func (n *Ncclient) withDefaultsElement(mode string) (string, error) {
+	switch mode {
+	case "":
+		return "", nil
+	case "report-all", "report-all-tagged", "trim", "explicit":
+	default:
+		return "", fmt.Errorf("invalid with-defaults mode %q: must be report-all, report-all-tagged, trim or explicit", mode)
+	}
+	if err := n.requireCapability(CAPABILITY_WITH_DEFAULTS); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`<with-defaults xmlns="urn:ietf:params:xml:ns:netconf:default:1.0">%s</with-defaults>`, mode), nil
+}
+
+// rpc sends body as an rpc and parses the reply. rpc-errors of severity
+// "error" are returned as the error alongside the reply.
+func (n *Ncclient) rpc(ctx context.Context, body string) (*RPCReply, error) {
+	raw, err := n.WriteRPCContext(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := ParseRPCReply(raw)
+	if reply != nil {
+		reply.stripDeclarations = n.stripDeclarations
+		if root, err := rootElement([]byte(body)); err == nil {
+			reply.Operation = root.Name.Local
+		}
+	}
+	return reply, err
+}
+
+// EditConfigOptions holds the optional parameters of an edit-config. Empty
+// fields are left out of the request so the server defaults apply.
+type EditConfigOptions struct {
+	// DefaultOperation is "merge", "replace" or "none".
+	DefaultOperation string
+	// TestOption is "test-then-set", "set" or "test-only".
+	TestOption string
+	// ErrorOption is "stop-on-error", "continue-on-error" or "rollback-on-error".
+	ErrorOption string
+}
+
+// optionElement renders <name>value</name>, checking value against the
+// values RFC 6241 allows. An empty value renders nothing.
+func optionElement(name string, value string, allowed ...string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !containsString(allowed, value) {
+		return "", fmt.Errorf("invalid %s %q", name, value)
+	}
+	return fmt.Sprintf("<%s>%s</%s>", name, value, name), nil
+}
+
+func (opts EditConfigOptions) render() (string, error) {
+	defaultOperation, err := optionElement("default-operation", opts.DefaultOperation, "merge", "replace", "none")
+	if err != nil {
+		return "", err
+	}
+	testOption, err := optionElement("test-option", opts.TestOption, "test-then-set", "set", "test-only")
+	if err != nil {
+		return "", err
+	}
+	errorOption, err := optionElement("error-option", opts.ErrorOption, "stop-on-error", "continue-on-error", "rollback-on-error")
+	if err != nil {
+		return "", err
+	}
+	return defaultOperation + testOption + errorOption, nil
+}
+
+// EditConfig loads config, the content of the <config> element, into the
+// target datastore. Operation attributes on individual nodes, which
+// SetOperation adds, are checked to be in the NETCONF namespace.
+func (n *Ncclient) EditConfig(target string, config string, opts EditConfigOptions) (*RPCReply, error) {
+	return n.EditConfigContext(context.Background(), target, config, opts)
+}
+
+// EditConfigContext is like EditConfig but gives up when ctx is done.
+func (n *Ncclient) EditConfigContext(ctx context.Context, target string, config string, opts EditConfigOptions) (*RPCReply, error) {
+	if err := checkOperations(config); err != nil {
+		return nil, err
+	}
+	return n.editConfig(ctx, target, fmt.Sprintf("<config>%s</config>", config), opts)
+}
+
+// EditConfigFromURL is like EditConfig but has the server load the
+// configuration from source, a URL such as
+// "sftp://backup.example.com/staged.xml", so a large configuration staged
+// elsewhere is not sent through the session. The server must advertise the
+// url capability with source's scheme among the ones it lists.
+func (n *Ncclient) EditConfigFromURL(target string, source string, opts EditConfigOptions) (*RPCReply, error) {
+	return n.EditConfigFromURLContext(context.Background(), target, source, opts)
+}
+
+// EditConfigFromURLContext is like EditConfigFromURL but gives up when ctx
+// is done.
+func (n *Ncclient) EditConfigFromURLContext(ctx context.Context, target string, source string, opts EditConfigOptions) (*RPCReply, error) {
+	if !strings.Contains(source, "://") {
+		return nil, fmt.Errorf("invalid url %q: edit-config loads configuration from a URL, not a datastore", source)
+	}
+	sourceElement, err := n.configOperand(source, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.editConfig(ctx, target, sourceElement, opts)
+}
+
+// editConfig sends an edit-config loading source, a <config> or <url>
+// element, into target.
+func (n *Ncclient) editConfig(ctx context.Context, target string, source string, opts EditConfigOptions) (*RPCReply, error) {
+	datastore, err := datastoreElement(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.requireDatastore(target, true); err != nil {
+		return nil, err
+	}
+	options, err := opts.render()
+	if err != nil {
+		return nil, err
+	}
+	if opts.TestOption != "" {
+		if err := n.requireCapability(CAPABILITY_VALIDATE_11, CAPABILITY_VALIDATE_10); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ErrorOption == "rollback-on-error" {
+		if err := n.requireCapability(CAPABILITY_ROLLBACK_ON_ERROR); err != nil {
+			return nil, err
+		}
+	}
+
+	rpc := fmt.Sprintf("<edit-config><target>%s</target>%s%s</edit-config>", datastore, options, source)
+	return n.rpc(ctx, rpc)
+}
+
+// editOperations are the values RFC 6241 allows for the operation
+// attribute of an edit-config.
+var editOperations = []string{"merge", "replace", "create", "delete", "remove"}
+
+// SetOperation returns element, a single XML element such as one node of
+// an edit-config, with the edit-config operation attribute set on it, so
+// the server applies operation, one of "merge", "replace", "create",
+// "delete" or "remove", to that node:
+//
+//	config, _ := SetOperation(`<interface><name>eth0</name></interface>`, "delete")
+//
+// gives
+//
+//	<interface xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="delete"><name>eth0</name></interface>
+//
+// Wrap the result in its parent elements as usual. element must not
+// already carry an operation attribute or bind the nc prefix.
+func SetOperation(element string, operation string) (string, error) {
+	if !containsString(editOperations, operation) {
+		return "", fmt.Errorf("invalid operation %q", operation)
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(element))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("invalid element: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "operation" {
+				return "", fmt.Errorf("element <%s> already has an operation", start.Name.Local)
+			}
+			if attr.Name.Space == "xmlns" && attr.Name.Local == "nc" {
+				return "", fmt.Errorf("element <%s> already binds the nc prefix", start.Name.Local)
+			}
+		}
+
+		// insert the attributes before the end of the start tag, which
+		// the decoder has just read up to
+		end := int(decoder.InputOffset()) - 1
+		if strings.HasSuffix(element[:end+1], "/>") {
+			end--
+		}
+		attrs := fmt.Sprintf(` xmlns:nc="%s" nc:operation="%s"`, NETCONF_NAMESPACE, operation)
+		return element[:end] + attrs + element[end:], nil
+	}
+}
+
+// checkOperations returns an error if an element of config has an
+// operation attribute outside the NETCONF namespace, which servers ignore
+// rather than apply, or with a value RFC 6241 does not allow. Config that
+// cannot be parsed is left for the server to reject.
+func checkOperations(config string) error {
+	decoder := xml.NewDecoder(strings.NewReader(config))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "operation" {
+				continue
+			}
+			if attr.Name.Space != NETCONF_NAMESPACE {
+				return fmt.Errorf("operation attribute on <%s> is not in the NETCONF namespace %s; see SetOperation", start.Name.Local, NETCONF_NAMESPACE)
+			}
+			if !containsString(editOperations, attr.Value) {
+				return fmt.Errorf("invalid operation %q on <%s>", attr.Value, start.Name.Local)
+			}
+		}
+	}
+}
+
+// Lock locks the target datastore for this session. Any datastore the
+// server has can be locked (RFC 6241 section 7.5), running included even
+// without writable-running, as the candidate workflow does to keep others
+// from changing it. Lock fails with ErrUnsupportedCapability without
+// sending anything if the target is candidate or startup and the server
+// does not advertise that datastore.
+func (n *Ncclient) Lock(target string) (*RPCReply, error) {
+	return n.LockContext(context.Background(), target)
+}
+
+// LockContext is like Lock but gives up when ctx is done.
+func (n *Ncclient) LockContext(ctx context.Context, target string) (*RPCReply, error) {
+	datastore, err := datastoreElement(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.requireDatastore(target, false); err != nil {
+		return nil, fmt.Errorf("cannot lock %s: %w", target, err)
+	}
+	return n.rpc(ctx, fmt.Sprintf("<lock><target>%s</target></lock>", datastore))
+}
+
+// LockWithRetry is like Lock but, while another session holds the lock,
+// tries again up to attempts times in all, at least once, sleeping backoff
+// after the first lock-denied or in-use error and doubling the sleep after
+// each one after that. Any other error is returned at once. If every
+// attempt fails, the last reply and error are returned; the session
+// holding the lock is then given by the SessionID of the *RPCError.
+func (n *Ncclient) LockWithRetry(target string, attempts int, backoff time.Duration) (*RPCReply, error) {
+	return n.LockWithRetryContext(context.Background(), target, attempts, backoff)
+}
+
+// LockWithRetryContext is like LockWithRetry but gives up when ctx is
+// done, including while sleeping between attempts.
+func (n *Ncclient) LockWithRetryContext(ctx context.Context, target string, attempts int, backoff time.Duration) (*RPCReply, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		reply, err := n.LockContext(ctx, target)
+		if attempt == attempts || !lockContention(err) {
+			return reply, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return reply, err
+		}
+		backoff *= 2
+	}
+}
+
+// Unlock releases a lock on the target datastore taken by Lock.
+func (n *Ncclient) Unlock(target string) (*RPCReply, error) {
+	return n.UnlockContext(context.Background(), target)
+}
+
+// UnlockContext is like Unlock but gives up when ctx is done.
+func (n *Ncclient) UnlockContext(ctx context.Context, target string) (*RPCReply, error) {
+	datastore, err := datastoreElement(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.requireDatastore(target, false); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<unlock><target>%s</target></unlock>", datastore))
+}
+
+// WithLock locks target, runs fn and unlocks target again, even when fn
+// fails. The error from fn takes precedence over an error unlocking.
+func (n *Ncclient) WithLock(target string, fn func() error) (err error) {
+	if _, err := n.Lock(target); err != nil {
+		return err
+	}
+	defer func() {
+		if _, unlockErr := n.Unlock(target); err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn()
+}
+
+// escapeText escapes s for use as XML character data.
+func escapeText(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// Commit commits the candidate configuration to running.
+func (n *Ncclient) Commit() (*RPCReply, error) {
+	return n.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but gives up when ctx is done.
+func (n *Ncclient) CommitContext(ctx context.Context) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_CANDIDATE); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, "<commit/>")
+}
+
+// CommitWithComment is like Commit but records comment with the commit,
+// for an audit trail of why a change was made. RFC 6241 has no commit
+// comment, so only Junos servers, recognised by CAPABILITY_JUNOS, record
+// it: they are sent their own <commit-configuration> with a <log>. Other
+// servers, and an empty comment, get a plain commit and the comment is
+// dropped.
+func (n *Ncclient) CommitWithComment(comment string) (*RPCReply, error) {
+	return n.CommitWithCommentContext(context.Background(), comment)
+}
+
+// CommitWithCommentContext is like CommitWithComment but gives up when ctx
+// is done.
+func (n *Ncclient) CommitWithCommentContext(ctx context.Context, comment string) (*RPCReply, error) {
+	if comment == "" || !n.HasCapability(CAPABILITY_JUNOS) {
+		return n.CommitContext(ctx)
+	}
+	if err := n.requireCapability(CAPABILITY_CANDIDATE); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<commit-configuration><log>%s</log></commit-configuration>", escapeText(comment)))
+}
+
+// CommitConfirmed commits the candidate configuration, rolling it back
+// unless a confirming commit follows within timeout. A zero timeout leaves
+// the server default (600 seconds). When persist is non-empty the confirmed
+// commit survives the end of this session and can be confirmed or
+// cancelled from another session using persist as the persist-id.
+func (n *Ncclient) CommitConfirmed(timeout time.Duration, persist string) (*RPCReply, error) {
+	return n.CommitConfirmedContext(context.Background(), timeout, persist)
+}
+
+// CommitConfirmedContext is like CommitConfirmed but gives up when ctx is
+// done.
+func (n *Ncclient) CommitConfirmedContext(ctx context.Context, timeout time.Duration, persist string) (*RPCReply, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid confirm-timeout %v", timeout)
+	}
+	if err := n.requireCapability(CAPABILITY_CANDIDATE); err != nil {
+		return nil, err
+	}
+	// persist was added in confirmed-commit:1.1
+	if persist != "" {
+		if err := n.requireCapability(CAPABILITY_CONFIRMED_COMMIT_11); err != nil {
+			return nil, err
+		}
+	} else if err := n.requireCapability(CAPABILITY_CONFIRMED_COMMIT_11, CAPABILITY_CONFIRMED_COMMIT_10); err != nil {
+		return nil, err
+	}
+
+	rpc := "<commit><confirmed/>"
+	if timeout > 0 {
+		seconds := int64(timeout / time.Second)
+		if timeout%time.Second != 0 {
+			seconds++
+		}
+		rpc += fmt.Sprintf("<confirm-timeout>%d</confirm-timeout>", seconds)
+	}
+	if persist != "" {
+		rpc += fmt.Sprintf("<persist>%s</persist>", escapeText(persist))
+	}
+	rpc += "</commit>"
+	return n.rpc(ctx, rpc)
+}
+
+// ConfirmCommit confirms an ongoing confirmed commit, making it permanent.
+// persistID must be given to confirm a persistent confirmed commit, from
+// this or any other session, and empty otherwise, in which case it is the
+// same as Commit.
+func (n *Ncclient) ConfirmCommit(persistID string) (*RPCReply, error) {
+	return n.ConfirmCommitContext(context.Background(), persistID)
+}
+
+// ConfirmCommitContext is like ConfirmCommit but gives up when ctx is done.
+func (n *Ncclient) ConfirmCommitContext(ctx context.Context, persistID string) (*RPCReply, error) {
+	if persistID == "" {
+		return n.CommitContext(ctx)
+	}
+	if err := n.requireCapability(CAPABILITY_CONFIRMED_COMMIT_11); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<commit><persist-id>%s</persist-id></commit>", escapeText(persistID)))
+}
+
+// PendingCommit is a persistent confirmed commit started by
+// StartConfirmedCommit, which rolls back unless confirmed in time.
+type PendingCommit struct {
+	// PersistID identifies the commit; another session can confirm or
+	// cancel it with ConfirmCommit or CancelCommit.
+	PersistID string
+
+	client *Ncclient
+}
+
+// StartConfirmedCommit starts a persistent confirmed commit under a newly
+// generated persist-id, for a two-phase deploy: commit, check that the
+// device is still reachable, then Confirm, or Cancel to roll back at once.
+// If neither happens within timeout the server rolls the change back
+// itself. Because the commit is persistent it survives this session
+// failing, and can be confirmed after a Reconnect.
+func (n *Ncclient) StartConfirmedCommit(timeout time.Duration) (*PendingCommit, *RPCReply, error) {
+	return n.StartConfirmedCommitContext(context.Background(), timeout)
+}
+
+// StartConfirmedCommitContext is like StartConfirmedCommit but gives up
+// when ctx is done.
+func (n *Ncclient) StartConfirmedCommitContext(ctx context.Context, timeout time.Duration) (*PendingCommit, *RPCReply, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate persist-id: %w", err)
+	}
+	pending := &PendingCommit{PersistID: hex.EncodeToString(token), client: n}
+
+	reply, err := n.CommitConfirmedContext(ctx, timeout, pending.PersistID)
+	if err != nil {
+		return nil, reply, err
+	}
+	return pending, reply, nil
+}
+
+// Confirm makes the pending commit permanent.
+func (p *PendingCommit) Confirm() (*RPCReply, error) {
+	return p.ConfirmContext(context.Background())
+}
+
+// ConfirmContext is like Confirm but gives up when ctx is done.
+func (p *PendingCommit) ConfirmContext(ctx context.Context) (*RPCReply, error) {
+	return p.client.ConfirmCommitContext(ctx, p.PersistID)
+}
+
+// Cancel rolls the pending commit back.
+func (p *PendingCommit) Cancel() (*RPCReply, error) {
+	return p.CancelContext(context.Background())
+}
+
+// CancelContext is like Cancel but gives up when ctx is done.
+func (p *PendingCommit) CancelContext(ctx context.Context) (*RPCReply, error) {
+	return p.client.CancelCommitContext(ctx, p.PersistID)
+}
+
+// CancelCommit cancels an ongoing confirmed commit. persistID must be given
+// to cancel a persistent confirmed commit and empty otherwise.
+func (n *Ncclient) CancelCommit(persistID string) (*RPCReply, error) {
+	return n.CancelCommitContext(context.Background(), persistID)
+}
+
+// CancelCommitContext is like CancelCommit but gives up when ctx is done.
+func (n *Ncclient) CancelCommitContext(ctx context.Context, persistID string) (*RPCReply, error) {
+	// cancel-commit was added in confirmed-commit:1.1
+	if err := n.requireCapability(CAPABILITY_CONFIRMED_COMMIT_11); err != nil {
+		return nil, err
+	}
+	if persistID == "" {
+		return n.rpc(ctx, "<cancel-commit/>")
+	}
+	return n.rpc(ctx, fmt.Sprintf("<cancel-commit><persist-id>%s</persist-id></cancel-commit>", escapeText(persistID)))
+}
+
+// CloseSession gracefully ends the NETCONF session, letting the server
+// release its locks and resources, then tears down the SSH connection.
+// Like after Close, later operations return ErrClosed until Connect is
+// called again.
+func (n *Ncclient) CloseSession() (*RPCReply, error) {
+	return n.CloseSessionContext(context.Background())
+}
+
+// CloseSessionContext is like CloseSession but gives up waiting for the
+// reply when ctx is done.
+func (n *Ncclient) CloseSessionContext(ctx context.Context) (*RPCReply, error) {
+	reply, err := n.rpc(ctx, "<close-session/>")
+	n.mu.Lock()
+	n.closeTransport()
+	n.closed = true
+	n.mu.Unlock()
+	return reply, err
+}
+
+// KillSession forces the termination of another NETCONF session, aborting
+// its operations and releasing its locks.
+func (n *Ncclient) KillSession(sessionID uint64) (*RPCReply, error) {
+	return n.KillSessionContext(context.Background(), sessionID)
+}
+
+// KillSessionContext is like KillSession but gives up when ctx is done.
+func (n *Ncclient) KillSessionContext(ctx context.Context, sessionID uint64) (*RPCReply, error) {
+	if sessionID == 0 {
+		return nil, fmt.Errorf("invalid session-id 0")
+	}
+	if sessionID == n.SessionID() {
+		return nil, fmt.Errorf("cannot kill own session %d, use CloseSession", sessionID)
+	}
+	return n.rpc(ctx, fmt.Sprintf("<kill-session><session-id>%d</session-id></kill-session>", sessionID))
+}
+
+// urlSchemes returns the URL schemes the server accepts, from the scheme
+// parameter of its url capability.
+func (n *Ncclient) urlSchemes() []string {
+	params, ok := n.CapabilityParams(CAPABILITY_URL)
+	if !ok || params["scheme"] == "" {
+		return nil
+	}
+	return strings.Split(params["scheme"], ",")
+}
+
+// configOperand renders the source or target of a copy-config: the element
+// naming a datastore, or a <url> element for anything containing "://".
+// The server must have the datastore, and be able to write it if writing.
+// URLs need the url capability and one of the schemes it lists.
+func (n *Ncclient) configOperand(operand string, writing bool) (string, error) {
+	if !strings.Contains(operand, "://") {
+		datastore, err := datastoreElement(operand)
+		if err != nil {
+			return "", err
+		}
+		if err := n.requireDatastore(operand, writing); err != nil {
+			return "", err
+		}
+		return datastore, nil
+	}
+
+	if err := n.requireCapability(CAPABILITY_URL); err != nil {
+		return "", err
+	}
+	parsed, err := url.Parse(operand)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", operand, err)
+	}
+	if !containsString(n.urlSchemes(), parsed.Scheme) {
+		return "", fmt.Errorf("url scheme %q is not supported by the server", parsed.Scheme)
+	}
+	return fmt.Sprintf("<url>%s</url>", escapeText(operand)), nil
+}
+
+// CopyConfig replaces the target configuration with the source. Each of
+// target and source is either a datastore name ("running", "candidate" or
+// "startup") or a URL such as "file:///tmp/backup.xml".
+func (n *Ncclient) CopyConfig(target string, source string) (*RPCReply, error) {
+	return n.CopyConfigContext(context.Background(), target, source)
+}
+
+// CopyConfigContext is like CopyConfig but gives up when ctx is done.
+func (n *Ncclient) CopyConfigContext(ctx context.Context, target string, source string) (*RPCReply, error) {
+	targetElement, err := n.configOperand(target, true)
+	if err != nil {
+		return nil, err
+	}
+	sourceElement, err := n.configOperand(source, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<copy-config><target>%s</target><source>%s</source></copy-config>", targetElement, sourceElement))
+}
+
+// SaveConfig copies the running configuration to the startup datastore so
+// it survives a reboot. The server must advertise the startup capability.
+func (n *Ncclient) SaveConfig() (*RPCReply, error) {
+	return n.SaveConfigContext(context.Background())
+}
+
+// SaveConfigContext is like SaveConfig but gives up when ctx is done.
+func (n *Ncclient) SaveConfigContext(ctx context.Context) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_STARTUP); err != nil {
+		return nil, err
+	}
+	return n.CopyConfigContext(ctx, "startup", "running")
+}
+
+// CopyConfigFrom is like CopyConfig but replaces the target configuration
+// with config, the content of a <config> element, instead of copying a
+// datastore or URL.
+func (n *Ncclient) CopyConfigFrom(target string, config string) (*RPCReply, error) {
+	return n.CopyConfigFromContext(context.Background(), target, config)
+}
+
+// CopyConfigFromContext is like CopyConfigFrom but gives up when ctx is
+// done.
+func (n *Ncclient) CopyConfigFromContext(ctx context.Context, target string, config string) (*RPCReply, error) {
+	targetElement, err := n.configOperand(target, true)
+	if err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<copy-config><target>%s</target><source><config>%s</config></source></copy-config>", targetElement, config))
+}
+
+// Validate checks the source configuration, a datastore name or URL, for
+// syntactic and semantic errors without applying it.
+func (n *Ncclient) Validate(source string) (*RPCReply, error) {
+	return n.ValidateContext(context.Background(), source)
+}
+
+// ValidateContext is like Validate but gives up when ctx is done.
+func (n *Ncclient) ValidateContext(ctx context.Context, source string) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_VALIDATE_11, CAPABILITY_VALIDATE_10); err != nil {
+		return nil, err
+	}
+	sourceElement, err := n.configOperand(source, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<validate><source>%s</source></validate>", sourceElement))
+}
+
+// ValidateConfig is like Validate but checks config, the content of a
+// <config> element, instead of a datastore.
+func (n *Ncclient) ValidateConfig(config string) (*RPCReply, error) {
+	return n.ValidateConfigContext(context.Background(), config)
+}
+
+// ValidateConfigContext is like ValidateConfig but gives up when ctx is
+// done.
+func (n *Ncclient) ValidateConfigContext(ctx context.Context, config string) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_VALIDATE_11, CAPABILITY_VALIDATE_10); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<validate><source><config>%s</config></source></validate>", config))
+}
+
+// DiscardChanges reverts the candidate configuration to the running
+// configuration, throwing away uncommitted changes.
+func (n *Ncclient) DiscardChanges() (*RPCReply, error) {
+	return n.DiscardChangesContext(context.Background())
+}
+
+// DiscardChangesContext is like DiscardChanges but gives up when ctx is
+// done.
+func (n *Ncclient) DiscardChangesContext(ctx context.Context) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_CANDIDATE); err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, "<discard-changes/>")
+}
+
+// DeleteConfig deletes the target configuration, a datastore name or URL.
+// The running datastore cannot be deleted.
+func (n *Ncclient) DeleteConfig(target string) (*RPCReply, error) {
+	return n.DeleteConfigContext(context.Background(), target)
+}
+
+// DeleteConfigContext is like DeleteConfig but gives up when ctx is done.
+func (n *Ncclient) DeleteConfigContext(ctx context.Context, target string) (*RPCReply, error) {
+	if target == "running" {
+		return nil, fmt.Errorf("the running datastore cannot be deleted")
+	}
+	targetElement, err := n.configOperand(target, true)
+	if err != nil {
+		return nil, err
+	}
+	return n.rpc(ctx, fmt.Sprintf("<delete-config><target>%s</target></delete-config>", targetElement))
+}
+
+// pingTimeout bounds how long Ping waits for its reply.
+const pingTimeout = 10 * time.Second
+
+// Ping checks that the NETCONF server is answering rpcs, not merely that
+// the connection is open. It sends a get with an empty subtree filter,
+// which selects no data, and succeeds if an rpc-reply comes back within 10
+// seconds, or the rpc timeout if that is shorter. A reply carrying
+// rpc-errors still shows the server is alive, so it counts as success.
+func (n *Ncclient) Ping() error {
+	return n.PingContext(context.Background())
+}
+
+// PingContext is like Ping but gives up when ctx is done.
+func (n *Ncclient) PingContext(ctx context.Context) error {
+	timeout := pingTimeout
+	if n.replyTimeout() < timeout {
+		timeout = n.replyTimeout()
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := n.rpc(pingCtx, `<get><filter type="subtree"/></get>`)
+	var rpcError *RPCError
+	if errors.As(err, &rpcError) {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return ErrTimeout
+	}
+	return err
+}
+
+// WaitForState polls the server with a get of filter, a subtree filter as
+// in Get, every interval until predicate reports that the reply shows the
+// wanted state, such as an interface coming up after an edit, and returns
+// nil. It returns an error wrapping ErrTimeout if that has not happened
+// within timeout, and the error of the first get that fails otherwise.
+// timeout is checked between polls: a get already sent is waited for with
+// the usual rpc timeout, so the session stays usable when the state is
+// not reached in time.
+func (n *Ncclient) WaitForState(filter string, predicate func(*RPCReply) bool, interval, timeout time.Duration) error {
+	return n.WaitForStateContext(context.Background(), filter, predicate, interval, timeout)
+}
+
+// WaitForStateContext is like WaitForState but gives up when ctx is done.
+func (n *Ncclient) WaitForStateContext(ctx context.Context, filter string, predicate func(*RPCReply) bool, interval, timeout time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid polling interval %v", interval)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: state not reached within %v", ErrTimeout, timeout)
+		}
+
+		reply, err := n.GetContext(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if predicate(reply) {
+			return nil
+		}
+		timer.Reset(interval)
+	}
+}
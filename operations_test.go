@@ -0,0 +1,143 @@
+package ncclient
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetOperation(t *testing.T) {
+	const nc = ` xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"`
+	tests := []struct {
+		element   string
+		operation string
+		want      string
+	}{
+		{`<interface><name>eth0</name></interface>`, "delete", `<interface` + nc + ` nc:operation="delete"><name>eth0</name></interface>`},
+		{`<interface/>`, "remove", `<interface` + nc + ` nc:operation="remove"/>`},
+		{`<interface xmlns="urn:x" a="1">x</interface>`, "replace", `<interface xmlns="urn:x" a="1"` + nc + ` nc:operation="replace">x</interface>`},
+		{`<!-- c --><interface>x</interface>`, "create", `<!-- c --><interface` + nc + ` nc:operation="create">x</interface>`},
+	}
+	for _, test := range tests {
+		got, err := SetOperation(test.element, test.operation)
+		if err != nil {
+			t.Errorf("SetOperation(%q, %q): %v", test.element, test.operation, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("SetOperation(%q, %q) = %s, want %s", test.element, test.operation, got, test.want)
+		}
+	}
+}
+
+func TestSetOperationInvalid(t *testing.T) {
+	tests := []struct {
+		element   string
+		operation string
+	}{
+		{`<interface/>`, "update"},
+		{`<interface nc:operation="merge" xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"/>`, "delete"},
+		{`<interface xmlns:nc="urn:x"/>`, "delete"},
+		{``, "delete"},
+		{`text`, "delete"},
+	}
+	for _, test := range tests {
+		if got, err := SetOperation(test.element, test.operation); err == nil {
+			t.Errorf("SetOperation(%q, %q) = %s, want an error", test.element, test.operation, got)
+		}
+	}
+}
+
+func TestCheckOperations(t *testing.T) {
+	valid := []string{
+		`<a/>`,
+		`<a xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="merge"/>`,
+		`<a xmlns:x="urn:ietf:params:xml:ns:netconf:base:1.0"><b x:operation="delete"/></a>`,
+	}
+	for _, config := range valid {
+		if err := checkOperations(config); err != nil {
+			t.Errorf("checkOperations(%q): %v", config, err)
+		}
+	}
+	invalid := []string{
+		`<a operation="delete"/>`,
+		`<a xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="update"/>`,
+	}
+	for _, config := range invalid {
+		if err := checkOperations(config); err == nil {
+			t.Errorf("checkOperations(%q) succeeded, want an error", config)
+		}
+	}
+}
+
+func TestLockCapabilities(t *testing.T) {
+	// a candidate-only server, such as Junos
+	n := &Ncclient{mu: new(sync.Mutex), capabilities: []string{NETCONF_BASE_10, CAPABILITY_CANDIDATE}}
+	for _, target := range []string{"running", "candidate"} {
+		if _, err := n.Lock(target); errors.Is(err, ErrUnsupportedCapability) {
+			t.Errorf("Lock(%q): %v", target, err)
+		}
+		if _, err := n.Unlock(target); errors.Is(err, ErrUnsupportedCapability) {
+			t.Errorf("Unlock(%q): %v", target, err)
+		}
+	}
+	if _, err := n.Lock("startup"); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("Lock(\"startup\") = %v, want %v", err, ErrUnsupportedCapability)
+	}
+}
+
+func TestCommitWithCommentWithoutJunos(t *testing.T) {
+	requests := make(chan string, 1)
+	client := connectFake(t, func(req string) string {
+		requests <- req
+		return "<ok/>"
+	})
+	if _, err := client.CommitWithComment("ticket 42"); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; !strings.Contains(req, "<commit/>") || strings.Contains(req, "ticket 42") {
+		t.Errorf("server without a commit comment extension was sent %s", req)
+	}
+}
+
+func TestLockWithRetry(t *testing.T) {
+	const denied = `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-info><session-id>42</session-id></error-info></rpc-error>`
+	for _, test := range []struct {
+		attempts int
+		granted  bool
+	}{
+		{3, true},
+		{2, false},
+	} {
+		locks := 0
+		client := connectPipe(t, func(s *pipeServer) {
+			// the lock is held elsewhere for the first two attempts
+			for {
+				content := "<ok/>"
+				if locks++; locks <= 2 {
+					content = denied
+				}
+				if err := s.reply(content); err != nil {
+					return
+				}
+			}
+		})
+
+		_, err := client.LockWithRetry("running", test.attempts, time.Millisecond)
+		if test.granted {
+			if err != nil {
+				t.Errorf("%d attempts: %v", test.attempts, err)
+			}
+			continue
+		}
+		var rpcError *RPCError
+		if !errors.As(err, &rpcError) || rpcError.Tag != "lock-denied" {
+			t.Fatalf("%d attempts: got %v, want lock-denied", test.attempts, err)
+		}
+		if id, ok := rpcError.SessionID(); !ok || id != 42 {
+			t.Errorf("SessionID() = %d, %v, want 42, true", id, ok)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package ncclient
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Option configures an Ncclient created by NewClient.
+type Option func(*Ncclient) error
+
+// WithUsername sets the SSH username.
+func WithUsername(username string) Option {
+	return func(n *Ncclient) error {
+		n.username = username
+		return nil
+	}
+}
+
+// WithPassword sets the SSH password.
+func WithPassword(password string) Option {
+	return func(n *Ncclient) error {
+		n.password = password
+		return nil
+	}
+}
+
+// WithKey sets a PEM encoded private key used for public key authentication.
+func WithKey(key string) Option {
+	return func(n *Ncclient) error {
+		n.key = key
+		return nil
+	}
+}
+
+// WithKeyFile reads a PEM encoded private key from path for public key
+// authentication.
+func WithKeyFile(path string) Option {
+	return func(n *Ncclient) error {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		n.key = string(key)
+		return nil
+	}
+}
+
+// WithKeyPassphrase decrypts a passphrase protected private key set with
+// WithKey or WithKeyFile.
+func WithKeyPassphrase(passphrase string) Option {
+	return func(n *Ncclient) error {
+		n.keyPassphrase = passphrase
+		return nil
+	}
+}
+
+// WithPort sets the port to connect to. By default, or when port is 0, the
+// client uses the IANA port of its transport: NETCONF_PORT (830) over SSH
+// and NETCONF_TLS_PORT (6513) over TLS. Devices that serve netconf on the
+// SSH port want 22.
+func WithPort(port int) Option {
+	return func(n *Ncclient) error {
+		n.port = port
+		return nil
+	}
+}
+
+// WithTimeout sets how long to wait for each reply, 30 seconds by default.
+// Operations given a context with a deadline wait until that deadline
+// instead. It is also how long connecting and the hello exchange may take,
+// unless WithConnectTimeout or WithHelloTimeout say otherwise, and how long
+// rpcs may take unless WithRPCTimeout does.
+func WithTimeout(timeout time.Duration) Option {
+	return func(n *Ncclient) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %v", timeout)
+		}
+		n.timeout = timeout
+		return nil
+	}
+}
+
+// WithConnectTimeout sets how long Connect waits for the TCP connection and
+// the SSH or TLS handshake to complete. It defaults to the reply timeout set
+// by WithTimeout.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(n *Ncclient) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid connect timeout %v", timeout)
+		}
+		n.connectTimeout = timeout
+		return nil
+	}
+}
+
+// WithHelloTimeout sets how long the hello exchange waits for the
+// server's hello, separately from the reply timeout set by WithTimeout,
+// which it defaults to. A server that never sends its hello makes Connect
+// fail with ErrTimeout once it passes.
+func WithHelloTimeout(timeout time.Duration) Option {
+	return func(n *Ncclient) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid hello timeout %v", timeout)
+		}
+		n.helloTimeout = timeout
+		return nil
+	}
+}
+
+// WithRPCTimeout sets how long to wait for the reply to each rpc,
+// separately from the timeout set by WithTimeout, which it defaults to and
+// which still applies to connecting and the hello exchange. A device that
+// is slow to accept connections can then be given a long WithTimeout
+// without a hung operation going unnoticed for as long. Operations given a
+// context with a deadline wait until that deadline instead.
+func WithRPCTimeout(timeout time.Duration) Option {
+	return func(n *Ncclient) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid rpc timeout %v", timeout)
+		}
+		n.rpcTimeout = timeout
+		return nil
+	}
+}
+
+// WithHostKeyCallback sets how the server's host key is verified, for
+// example with a callback returned by KnownHosts.
+func WithHostKeyCallback(hostKeyCallback ssh.HostKeyCallback) Option {
+	return func(n *Ncclient) error {
+		n.hostKeyCallback = hostKeyCallback
+		return nil
+	}
+}
+
+// WithSSHConfig sets the key exchanges, ciphers and MACs the SSH
+// transport offers, and the rekey threshold, from the Config embedded in
+// ssh.ClientConfig, to reach legacy devices that only support older
+// algorithms or to insist on strong ones. Empty lists keep the SSH
+// package defaults, and algorithms it does not implement are ignored.
+//
+// The SSH package only implements the "none" compression method, so
+// sessions are never compressed. On links where bandwidth costs more than
+// CPU, run the session through a compressing tunnel instead, such as one
+// forwarded with OpenSSH's ssh -C -L, and pass a connection to its local
+// end with WithConn.
+func WithSSHConfig(config ssh.Config) Option {
+	return func(n *Ncclient) error {
+		n.sshConfig = config
+		return nil
+	}
+}
+
+// WithTLS connects with NETCONF over TLS (RFC 7589) instead of SSH, on port
+// 6513 unless another port is set. Client certificates for authentication go
+// in config.Certificates.
+func WithTLS(config *tls.Config) Option {
+	return func(n *Ncclient) error {
+		if config == nil {
+			return fmt.Errorf("nil TLS config")
+		}
+		n.tlsConfig = config
+		return nil
+	}
+}
+
+// NewClient returns a client for hostname configured by opts. It does not
+// connect; call Connect for that. Unless overridden the client connects to
+// port 830 over SSH, waits 30 seconds for each reply and rejects every host
+// key.
+func NewClient(hostname string, opts ...Option) (*Ncclient, error) {
+	nc := &Ncclient{
+		hostname:     hostname,
+		timeout:      time.Second * 30,
+		rpcNamespace: NETCONF_NAMESPACE,
+		mu:           new(sync.Mutex),
+		closeMu:      new(sync.Mutex),
+	}
+	for _, opt := range opts {
+		if err := opt(nc); err != nil {
+			return nil, err
+		}
+	}
+	return nc, nil
+}
+
+// WithAgent authenticates with the keys held by the ssh-agent listening on
+// SSH_AUTH_SOCK. Agent keys are tried before any key or password.
+func WithAgent() Option {
+	return func(n *Ncclient) error {
+		n.useAgent = true
+		return nil
+	}
+}
+
+// WithKeyboardInteractive also tries keyboard-interactive authentication,
+// after the password, answering the server's prompts with the configured
+// password. Devices authenticating against TACACS+ or RADIUS often accept
+// nothing else.
+func WithKeyboardInteractive() Option {
+	return func(n *Ncclient) error {
+		n.keyboardInteractive = true
+		return nil
+	}
+}
+
+// WithAuthMethods sets the SSH authentication methods to try, in the order
+// given, for example to add keyboard-interactive or certificate
+// authentication. It replaces the default methods built from WithAgent,
+// WithKey and WithPassword.
+func WithAuthMethods(methods ...ssh.AuthMethod) Option {
+	return func(n *Ncclient) error {
+		if len(methods) == 0 {
+			return fmt.Errorf("no SSH authentication methods given")
+		}
+		n.sshAuth = methods
+		return nil
+	}
+}
+
+// WithCapabilities replaces DefaultCapabilities as the capabilities
+// advertised in the client hello.
+func WithCapabilities(capabilities ...string) Option {
+	return func(n *Ncclient) error {
+		n.clientCapabilities = append([]string{}, capabilities...)
+		return nil
+	}
+}
+
+// WithExtraCapabilities advertises capabilities in addition to the ones
+// already configured, DefaultCapabilities unless WithCapabilities was used.
+// Capabilities already configured are not repeated.
+func WithExtraCapabilities(capabilities ...string) Option {
+	return func(n *Ncclient) error {
+		current := DefaultCapabilities
+		if n.clientCapabilities != nil {
+			current = n.clientCapabilities
+		}
+		n.clientCapabilities = append([]string(nil), current...)
+		for _, capability := range capabilities {
+			if !containsString(n.clientCapabilities, capability) {
+				n.clientCapabilities = append(n.clientCapabilities, capability)
+			}
+		}
+		return nil
+	}
+}
+
+// WithBase10 leaves base:1.1 out of the client hello, whatever else is
+// advertised, so the session uses base:1.0 and end-of-message framing even
+// with servers that support base:1.1. It is meant for servers whose
+// base:1.1 implementation is broken.
+func WithBase10() Option {
+	return func(n *Ncclient) error {
+		n.forceBase10 = true
+		return nil
+	}
+}
+
+// WithRPCNamespace sets the XML namespace the <rpc> element is sent in,
+// NETCONF_NAMESPACE by default, for servers expecting a vendor specific
+// one. An empty namespace sends the <rpc> without a namespace declaration.
+func WithRPCNamespace(namespace string) Option {
+	return func(n *Ncclient) error {
+		n.rpcNamespace = namespace
+		return nil
+	}
+}
+
+// WithDefaultFilter sets the filter Get and GetConfig, and their variants,
+// use when called without one, for tools that always query the same
+// subtree. A filter given in a call replaces it; pass AllFilter to a
+// WithFilter variant to select everything for one call.
+func WithDefaultFilter(filter Filter) Option {
+	return func(n *Ncclient) error {
+		switch filter.Type {
+		case "", "all", "subtree", "xpath":
+		default:
+			return fmt.Errorf("invalid filter type %q: must be subtree or xpath", filter.Type)
+		}
+		n.defaultFilter = filter
+		return nil
+	}
+}
+
+// WithStripDataDeclarations makes Data leave out XML declarations, such
+// as <?xml version="1.0"?>, that some devices put in front of the data
+// they return, so data from every reply can be embedded in another
+// document. RawReply still holds the reply exactly as received.
+func WithStripDataDeclarations() Option {
+	return func(n *Ncclient) error {
+		n.stripDeclarations = true
+		return nil
+	}
+}
+
+// WithConn runs the session over conn, an already open connection such as
+// a unix socket, a pre-authenticated tunnel or one end of a net.Pipe in
+// tests, instead of dialing the server. The SSH or TLS handshake is done
+// over conn as usual, and the hostname is still used to verify the host
+// key or certificate. conn can carry only one session, so once it is
+// closed Reconnect fails.
+func WithConn(conn net.Conn) Option {
+	return func(n *Ncclient) error {
+		if conn == nil {
+			return fmt.Errorf("nil connection")
+		}
+		n.conn = conn
+		return nil
+	}
+}
+
+// WithJumpHost reaches the server through an established SSH connection to a
+// bastion host instead of dialing it directly. The jump host connection is
+// not closed by the client.
+func WithJumpHost(jumpHost *ssh.Client) Option {
+	return func(n *Ncclient) error {
+		n.jumpHost = jumpHost
+		return nil
+	}
+}
+
+// WithDialer makes Connect open the connection to the server with dial,
+// such as the DialContext of a SOCKS proxy dialer or one going through a
+// service mesh, instead of dialing directly. The SSH or TLS handshake is
+// done over the connection as usual. dial is called with network "tcp"
+// and the server's host and port, and a ctx that ends when the connect
+// timeout passes or Connect is given up. It cannot be combined with
+// WithJumpHost.
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(n *Ncclient) error {
+		if dial == nil {
+			return fmt.Errorf("nil dialer")
+		}
+		n.dialer = dial
+		return nil
+	}
+}
+
+// WithLogger sets a logger for the messages the client exchanges; see
+// SetLogger.
+func WithLogger(logger LogFunc) Option {
+	return func(n *Ncclient) error {
+		n.logger = logger
+		return nil
+	}
+}
+
+// WithTrafficCapture writes a copy of every byte read from and written to
+// the session to w, framing included, for troubleshooting at the wire
+// level. Unlike the logger, which sees whole messages, it records each read
+// and write as it happens: a line with the UTC time, "send" or "receive"
+// and the byte count, then the bytes and a newline. w is written from the
+// goroutine reading the session as well as from operations, but never
+// concurrently by one client; clients sharing w must synchronize it
+// themselves. Write errors on w are ignored. The capture holds everything
+// exchanged, so treat it as sensitive.
+func WithTrafficCapture(w io.Writer) Option {
+	return func(n *Ncclient) error {
+		if w == nil {
+			return fmt.Errorf("nil traffic capture writer")
+		}
+		n.capture = w
+		return nil
+	}
+}
+
+// WithKeepalive sends an SSH keepalive every interval, keeping idle sessions
+// alive through firewalls and NAT. If maxMissed keepalives in a row go
+// unanswered the connection is torn down, so operations fail straight away
+// with ErrSessionUnusable rather than waiting out their timeout. It has no
+// effect on TLS connections.
+func WithKeepalive(interval time.Duration, maxMissed int) Option {
+	return func(n *Ncclient) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid keepalive interval %v", interval)
+		}
+		if maxMissed < 1 {
+			return fmt.Errorf("invalid keepalive maxMissed %d", maxMissed)
+		}
+		n.keepaliveInterval = interval
+		n.keepaliveMaxMissed = maxMissed
+		return nil
+	}
+}
+
+// WithCommand runs command over SSH and speaks NETCONF on its stdin and
+// stdout instead of requesting the netconf subsystem, for servers reached
+// through a wrapper such as "sudo netconf" or a container shim. The
+// command's output must be nothing but NETCONF messages. Passing
+// NETCONF_XML_MODE_COMMAND goes straight to xml-mode, unlike
+// WithXMLModeFallback, which tries the subsystem first.
+func WithCommand(command string) Option {
+	return func(n *Ncclient) error {
+		if command == "" {
+			return fmt.Errorf("empty command")
+		}
+		n.command = command
+		return nil
+	}
+}
+
+// WithMissingDelimiterFallback accepts replies from servers that never
+// send the ]]>]]> delimiter. The delimiter still ends a message when it
+// comes, but once a complete, well-formed <rpc-reply> or <hello> has been
+// read and nothing more arrives for grace, the message is taken to have
+// ended. Only end-of-message framing is affected. A delimiter that turns up
+// after grace after all is ignored.
+func WithMissingDelimiterFallback(grace time.Duration) Option {
+	return func(n *Ncclient) error {
+		if grace <= 0 {
+			return fmt.Errorf("invalid delimiter grace period %v", grace)
+		}
+		n.delimiterGrace = grace
+		return nil
+	}
+}
+
+// WithMaxResponseSize limits every message from the server, framing
+// excluded, to size bytes, as a safety valve against servers sending
+// unbounded data. The operation whose reply exceeds it fails with
+// ErrResponseTooLarge without the rest being read, and the session becomes
+// unusable. Replies read with WriteRPCStream are limited too. By default
+// there is no limit.
+func WithMaxResponseSize(size int64) Option {
+	return func(n *Ncclient) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid maximum response size %d", size)
+		}
+		n.maxResponseSize = size
+		return nil
+	}
+}
+
+// WithReplyValidation checks that every reply, including the server's
+// hello, is a well-formed XML document before it is returned, so a reply
+// cut short or garbled by a framing bug fails with a *MalformedReplyError,
+// which matches ErrMalformedReply and holds the reply, rather than deep in
+// the caller's parsing. What the server sent after such a reply cannot be
+// told apart from the next reply, so the session is unusable afterwards and
+// the client must Reconnect. Replies read with WriteRPCStream are not
+// checked.
+func WithReplyValidation() Option {
+	return func(n *Ncclient) error {
+		n.validateReplies = true
+		return nil
+	}
+}
+
+// WithSynchronousReads makes each operation read its reply in the calling
+// goroutine rather than receive it from the goroutine that otherwise reads
+// the session, so a hung read shows up in the caller's stack. The timeout
+// is enforced with a read deadline on transports that have one, such as
+// TLS, and by closing the transport otherwise. Notifications are only read
+// while an operation waits for its reply, and cancelling a context without
+// a deadline takes effect only once the reply has been read.
+func WithSynchronousReads() Option {
+	return func(n *Ncclient) error {
+		n.synchronousReads = true
+		return nil
+	}
+}
+
+// WithXMLModeFallback runs NETCONF_XML_MODE_COMMAND in a new SSH session
+// when the server has no netconf subsystem, as older JunOS and some IOS
+// devices require.
+func WithXMLModeFallback() Option {
+	return func(n *Ncclient) error {
+		n.xmlModeFallback = true
+		return nil
+	}
+}
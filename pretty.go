@@ -0,0 +1,150 @@
+package ncclient
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// prettyIndent is the indentation PrettyXML adds per level of nesting.
+const prettyIndent = "  "
+
+// PrettyXML re-indents the XML document read from r, such as a reply, two
+// spaces per level with one element per line, so output from devices that
+// format it differently can be read and diffed. Only whitespace between
+// elements changes: tags, namespace declarations and prefixes, entities,
+// comments and CDATA sections are copied as they were, and an element
+// holding text, alone or mixed with elements or CDATA sections, is copied
+// unchanged onto one line, as in <name>eth0</name>.
+func PrettyXML(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := rawTokens(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	depth := 0
+	line := func(raw []byte) {
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(strings.Repeat(prettyIndent, depth))
+		out.Write(raw)
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.token.(type) {
+		case xml.StartElement:
+			line(t.raw)
+			// a self-closing element is followed by an end element that
+			// takes up no input
+			if i+1 < len(tokens) && isEnd(tokens[i+1]) && len(tokens[i+1].raw) == 0 {
+				i++
+				continue
+			}
+			// keep an element holding nothing, only text or text mixed
+			// with other content on one line, as it was
+			if end, inline := inlineElement(tokens, i); inline {
+				for _, t := range tokens[i+1 : end+1] {
+					out.Write(t.raw)
+				}
+				i = end
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			line(t.raw)
+		case xml.CharData:
+			// whitespace between elements is replaced by the indentation
+			if len(bytes.TrimSpace(t.raw)) == 0 {
+				continue
+			}
+			// text mixed in with elements
+			line(bytes.TrimSpace(t.raw))
+		default:
+			line(t.raw)
+		}
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// rawToken is a token along with the input it was read from.
+type rawToken struct {
+	token xml.Token
+	raw   []byte
+}
+
+// rawTokens splits data into tokens, without namespace translation, keeping
+// the input of each. RawToken does not match end elements to start
+// elements, so that is checked here.
+func rawTokens(data []byte) ([]rawToken, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var tokens []rawToken
+	var open []xml.Name
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			if len(open) != 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			open = append(open, t.Name)
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != t.Name {
+				return nil, fmt.Errorf("unexpected end element </%s>", t.Name.Local)
+			}
+			open = open[:len(open)-1]
+		}
+		tokens = append(tokens, rawToken{xml.CopyToken(token), data[start:decoder.InputOffset()]})
+	}
+}
+
+// inlineElement returns the index of the end element matching the start
+// element at tokens[start], and whether the element is to be kept on one
+// line: it is empty, holds only whitespace, or has text or a CDATA section
+// among its children, which re-indenting would change.
+func inlineElement(tokens []rawToken, start int) (end int, inline bool) {
+	empty := true
+	depth := 0
+	for i := start + 1; i < len(tokens); i++ {
+		switch tokens[i].token.(type) {
+		case xml.StartElement:
+			depth++
+			empty = false
+		case xml.EndElement:
+			if depth == 0 {
+				return i, inline || empty
+			}
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(tokens[i].raw)) != 0 {
+				inline = true
+			}
+		default:
+			empty = false
+		}
+	}
+	// rawTokens only returns balanced elements
+	return len(tokens) - 1, inline || empty
+}
+
+func isEnd(t rawToken) bool {
+	_, ok := t.token.(xml.EndElement)
+	return ok
+}
@@ -0,0 +1,83 @@
+package ncclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrettyXML(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><data><a><name>eth0</name><mtu>1500</mtu><empty/><none></none></a></data></rpc-reply>`,
+			`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+  <data>
+    <a>
+      <name>eth0</name>
+      <mtu>1500</mtu>
+      <empty/>
+      <none></none>
+    </a>
+  </data>
+</rpc-reply>
+`,
+		},
+		{
+			"<?xml version=\"1.0\"?>\n<a>\n        <b>x &amp; y</b>\n\t<!-- c -->\n</a>\n",
+			`<?xml version="1.0"?>
+<a>
+  <b>x &amp; y</b>
+  <!-- c -->
+</a>
+`,
+		},
+		{
+			`<x:a xmlns:x="urn:x"><x:b><![CDATA[<raw>]]></x:b></x:a>`,
+			`<x:a xmlns:x="urn:x">
+  <x:b><![CDATA[<raw>]]></x:b>
+</x:a>
+`,
+		},
+		{
+			// mixed content is kept as it was
+			`<a><f>p<![CDATA[q]]></f><g>x <b>y</b> z</g><h>
+ <i/> </h></a>`,
+			`<a>
+  <f>p<![CDATA[q]]></f>
+  <g>x <b>y</b> z</g>
+  <h>
+    <i/>
+  </h>
+</a>
+`,
+		},
+		{
+			`<a><b><![CDATA[]]></b><c> </c></a>`,
+			`<a>
+  <b><![CDATA[]]></b>
+  <c> </c>
+</a>
+`,
+		},
+	}
+	for _, test := range tests {
+		got, err := PrettyXML(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("PrettyXML(%q): %v", test.input, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("PrettyXML(%q) =\n%s\nwant\n%s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestPrettyXMLInvalid(t *testing.T) {
+	for _, input := range []string{`<a><b></a></b>`, `<a>`, `</a>`, `<a></a`} {
+		if got, err := PrettyXML(strings.NewReader(input)); err == nil {
+			t.Errorf("PrettyXML(%q) = %q, want an error", input, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ncclient
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrRawNeedsSynchronousReads is returned by SendRaw and ReadRaw on a
+// client not created WithSynchronousReads, whose session reader would
+// otherwise decode whatever the server sends in answer.
+var ErrRawNeedsSynchronousReads = errors.New("raw access to the session requires WithSynchronousReads")
+
+// rawReadSize is how much ReadRaw reads at most at a time.
+const rawReadSize = 64 * 1024
+
+// SendRaw writes data to the session as it is, without an <rpc> wrapper,
+// message-id or framing, for conformance testing and fuzzing. Nothing is
+// checked, so data may well leave the session unusable. It requires a
+// client created WithSynchronousReads, and replies to it are read with
+// ReadRaw.
+func (n *Ncclient) SendRaw(data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.rawSession(); err != nil {
+		return err
+	}
+	n.log(LogSend, string(data))
+	_, err := n.transport.Write(data)
+	return err
+}
+
+// ReadRaw returns whatever the server has sent that has not been read yet,
+// framing included, waiting until deadline for something to arrive, or
+// indefinitely for the zero time. It returns ErrTimeout if nothing arrived
+// in time. Like SendRaw it requires a client created WithSynchronousReads.
+// On transports without a read deadline, such as SSH, the wait is ended by
+// closing the session, so ErrTimeout leaves it unusable.
+func (n *Ncclient) ReadRaw(deadline time.Time) ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.rawSession(); err != nil {
+		return nil, err
+	}
+
+	hasDeadline := false
+	if !deadline.IsZero() {
+		hasDeadline = n.setReadDeadline(deadline)
+		if hasDeadline {
+			defer n.setReadDeadline(time.Time{})
+		} else {
+			transport := n.transport
+			timer := time.AfterFunc(time.Until(deadline), func() { transport.Close() })
+			defer timer.Stop()
+		}
+	}
+
+	// take everything already buffered, or else what the next read brings
+	r := n.reader.buffered
+	size := r.Buffered()
+	if size == 0 {
+		size = rawReadSize
+	}
+	data := make([]byte, size)
+	read, err := r.Read(data)
+	if read > 0 {
+		n.log(LogReceive, string(data[:read]))
+		return data[:read], nil
+	}
+	if hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		n.abandon(ErrTimeout)
+		return nil, ErrTimeout
+	}
+	return nil, n.readFailed(context.Background(), err)
+}
+
+// rawSession returns why the session cannot be used by SendRaw or ReadRaw,
+// nil if it can. The caller must hold n.mu.
+func (n *Ncclient) rawSession() error {
+	if n.closed {
+		return ErrClosed
+	}
+	if n.transport == nil {
+		return ErrNotConnected
+	}
+	if n.broken != nil {
+		return n.broken
+	}
+	if !n.reader.synchronous {
+		return ErrRawNeedsSynchronousReads
+	}
+	return nil
+}
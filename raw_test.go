@@ -0,0 +1,45 @@
+package ncclient
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFakeServerRaw(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<data><a/></data>" }, WithSynchronousReads())
+
+	rpc := `<rpc xmlns="` + NETCONF_NAMESPACE + `" message-id="raw-1"><get/></rpc>` + NETCONF_DELIM
+	if err := client.SendRaw([]byte(rpc)); err != nil {
+		t.Fatal(err)
+	}
+	// the reply may arrive in pieces, and comes with its framing
+	var reply []byte
+	for !bytes.HasSuffix(reply, []byte(NETCONF_DELIM)) {
+		data, err := client.ReadRaw(time.Now().Add(5 * time.Second))
+		if err != nil {
+			t.Fatalf("ReadRaw after %q: %v", reply, err)
+		}
+		reply = append(reply, data...)
+	}
+	if got := string(reply); !strings.Contains(got, `message-id="raw-1"`) || !strings.Contains(got, "<data><a/></data>") {
+		t.Errorf("raw reply = %q", got)
+	}
+
+	// nothing else is sent, so the next read runs out of time
+	if _, err := client.ReadRaw(time.Now().Add(50 * time.Millisecond)); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestRawNeedsSynchronousReads(t *testing.T) {
+	client := connectPipe(t, func(*pipeServer) {})
+	if err := client.SendRaw([]byte("<rpc/>")); !errors.Is(err, ErrRawNeedsSynchronousReads) {
+		t.Errorf("SendRaw: got %v, want %v", err, ErrRawNeedsSynchronousReads)
+	}
+	if _, err := client.ReadRaw(time.Time{}); !errors.Is(err, ErrRawNeedsSynchronousReads) {
+		t.Errorf("ReadRaw: got %v, want %v", err, ErrRawNeedsSynchronousReads)
+	}
+}
@@ -0,0 +1,368 @@
+package ncclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// sessionReader decodes every message the server sends on a session and
+// hands them to Write in order, except for notifications which go to their
+// own channel and a reply requested as a stream, which is copied to its
+// stream as it is decoded. A single reader owns the buffered session stdout
+// for the life of the session, so bytes read past the end of one message
+// are kept for the next instead of being discarded.
+//
+// A synchronous reader, see WithSynchronousReads, has no goroutine of its
+// own. Write reads its reply by calling next, and messages is nil.
+type sessionReader struct {
+	messages      chan *bytes.Buffer
+	notifications chan *Notification
+	// err is why reading stopped; it is valid once messages is closed
+	err error
+	// ended is closed once reading has stopped
+	ended   chan struct{}
+	endOnce sync.Once
+
+	synchronous bool
+	buffered    *bufio.Reader
+	closeOnce   sync.Once
+
+	// framing is how messages from the server are decoded. It switches
+	// as soon as the server's hello is read, since the messages after it
+	// may already be buffered; local is what the client advertises, to
+	// negotiate it with.
+	framing   framingMode
+	local     []string
+	helloRead bool
+
+	// stopNotifications is closed by StopNotifications; notifyMu is held
+	// while a notification is delivered so that notifications is never
+	// closed during a send
+	stopNotifications chan struct{}
+	stopOnce          sync.Once
+	notifyMu          sync.Mutex
+	notifyStopped     bool
+
+	// source reads the session for buffered when replies missing their
+	// delimiter are accepted, so the reader can wait for data with a
+	// timeout
+	source *pumpReader
+
+	mu sync.Mutex
+	// stream receives the next rpc-reply, if set
+	stream *replyStream
+}
+
+// notificationBuffer is how many notifications are held for the caller
+// before the reader waits for them to be received.
+const notificationBuffer = 64
+
+func startSessionReader(n *Ncclient, stdout io.Reader) *sessionReader {
+	reader := &sessionReader{
+		notifications:     make(chan *Notification, notificationBuffer),
+		stopNotifications: make(chan struct{}),
+		ended:             make(chan struct{}),
+		synchronous:       n.synchronousReads,
+		local:             n.localCapabilities(),
+	}
+	if n.delimiterGrace > 0 {
+		reader.source = newPumpReader(stdout)
+		stdout = reader.source
+	}
+	reader.buffered = bufio.NewReader(stdout)
+	if !reader.synchronous {
+		reader.messages = make(chan *bytes.Buffer, 1)
+		go reader.run(n)
+	}
+	return reader
+}
+
+// expectStream sends the next rpc-reply to stream instead of Write.
+func (s *sessionReader) expectStream(stream *replyStream) {
+	s.mu.Lock()
+	s.stream = stream
+	s.mu.Unlock()
+}
+
+// takeStream clears and returns the stream waiting for a reply, if any.
+func (s *sessionReader) takeStream() *replyStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.stream
+	s.stream = nil
+	return stream
+}
+
+func (s *sessionReader) pendingStream() *replyStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream
+}
+
+func (s *sessionReader) run(n *Ncclient) {
+	defer close(s.messages)
+	for {
+		msg, err := s.readMessage(n)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		if msg != nil {
+			s.messages <- msg
+		}
+	}
+}
+
+// next reads messages until one that is neither a notification nor a
+// streamed reply arrives, for a synchronous reader.
+func (s *sessionReader) next(n *Ncclient) (*bytes.Buffer, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	for {
+		msg, err := s.readMessage(n)
+		if err != nil {
+			s.fail(err)
+			return nil, err
+		}
+		if msg != nil {
+			return msg, nil
+		}
+	}
+}
+
+// readStream reads messages until the waiting stream has its reply, for a
+// synchronous reader.
+func (s *sessionReader) readStream(n *Ncclient) {
+	for s.pendingStream() != nil {
+		if _, err := s.readMessage(n); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// fail records why reading stopped, ends a waiting stream and closes the
+// notifications channel.
+func (s *sessionReader) fail(err error) {
+	s.err = err
+	s.endOnce.Do(func() { close(s.ended) })
+	if stream := s.takeStream(); stream != nil {
+		stream.finish(err)
+	}
+	s.closeOnce.Do(func() { close(s.notifications) })
+}
+
+// readMessage decodes the next message. Notifications and a streamed reply
+// are delivered where they belong and nil is returned for them.
+func (s *sessionReader) readMessage(n *Ncclient) (*bytes.Buffer, error) {
+	r := s.buffered
+	// the framing switches once the hellos are exchanged, so wait for
+	// the next message to start before deciding how to decode it
+	if err := skipSpace(r); err != nil {
+		return nil, err
+	}
+
+	var sink io.Writer
+	var msg *bytes.Buffer
+	var streamSink *replySink
+	if stream := s.pendingStream(); stream != nil {
+		streamSink = &replySink{stream: stream}
+		sink = streamSink
+	} else {
+		msg = new(bytes.Buffer)
+		sink = msg
+	}
+
+	if n.maxResponseSize > 0 {
+		sink = &limitedWriter{w: sink, remaining: n.maxResponseSize}
+	}
+
+	var err error
+	if s.framing == framingChunked {
+		err = readChunkedMessage(r, sink)
+	} else if s.source != nil {
+		err = readEOMMessageWithFallback(r, sink, &delimiterFallback{source: s.source, grace: n.delimiterGrace})
+	} else {
+		err = readEOMMessage(r, sink)
+	}
+	if err != nil {
+		// a complete reply is delivered even if the server hung up before
+		// its delimiter or end of chunks; the next read reports the end
+		if msg == nil || !isEOF(err) || !completeReply(msg.Bytes()) {
+			return nil, err
+		}
+	}
+
+	if streamSink != nil {
+		if streamSink.streaming {
+			s.takeStream().finish(nil)
+			return nil, nil
+		}
+		msg = streamSink.message()
+	}
+	if msg.Len() == 0 {
+		// a delimiter arriving after its message was ended without it
+		return nil, nil
+	}
+
+	root, err := rootElement(msg.Bytes())
+	if err == nil && root.Name.Local == "hello" && !s.helloRead {
+		s.helloRead = true
+		if remote, err := ParseHello(msg.Bytes()); err == nil {
+			s.framing = negotiateFraming(s.local, remote.Capabilities)
+		}
+	}
+	if err == nil && root.Name.Local == "notification" {
+		// a notification is never a reply, even one that cannot be parsed
+		if notification, err := parseNotification(msg.Bytes()); err == nil {
+			s.notify(notification)
+		}
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// stopped reports whether reading has stopped, because the session ended
+// or could not be decoded any further.
+func (s *sessionReader) stopped() bool {
+	select {
+	case <-s.ended:
+		return true
+	default:
+		return false
+	}
+}
+
+// notify delivers a notification, or drops it once notifications have
+// been stopped.
+func (s *sessionReader) notify(notification *Notification) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	if s.notifyStopped {
+		return
+	}
+	select {
+	case s.notifications <- notification:
+	case <-s.stopNotifications:
+	}
+}
+
+// stopNotify drops notifications from now on and closes the notifications
+// channel.
+func (s *sessionReader) stopNotify() {
+	// wake a delivery waiting for room, then wait for it to give up
+	s.stopOnce.Do(func() { close(s.stopNotifications) })
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.notifyStopped = true
+	s.closeOnce.Do(func() { close(s.notifications) })
+}
+
+// isEOF reports whether err means the session ended.
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// limitedWriter writes to w until remaining bytes have been written and
+// fails with ErrResponseTooLarge after that, writing nothing more.
+type limitedWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		return 0, ErrResponseTooLarge
+	}
+	l.remaining -= int64(len(p))
+	return l.w.Write(p)
+}
+
+// pumpReader reads from a reader in its own goroutine, so that its
+// consumer can wait for data with a timeout.
+type pumpReader struct {
+	chunks chan []byte
+	// err is why reading stopped; it is valid once chunks is closed
+	err     error
+	pending []byte
+	drained bool
+}
+
+func newPumpReader(r io.Reader) *pumpReader {
+	p := &pumpReader{chunks: make(chan []byte)}
+	go p.pump(r)
+	return p
+}
+
+func (p *pumpReader) pump(r io.Reader) {
+	defer close(p.chunks)
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := r.Read(buf)
+		if n > 0 {
+			p.chunks <- buf[:n]
+		}
+		if err != nil {
+			p.err = err
+			return
+		}
+	}
+}
+
+func (p *pumpReader) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		if p.drained {
+			return 0, p.err
+		}
+		chunk, ok := <-p.chunks
+		if !ok {
+			p.drained = true
+			return 0, p.err
+		}
+		p.pending = chunk
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// wait reports whether data, or the end of the data, arrives within
+// timeout, in which case Read does not block.
+func (p *pumpReader) wait(timeout time.Duration) bool {
+	if len(p.pending) > 0 || p.drained {
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case chunk, ok := <-p.chunks:
+		if !ok {
+			p.drained = true
+		}
+		p.pending = chunk
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// skipSpace discards whitespace, such as the newline many servers send after
+// a delimiter, up to the start of the next message.
+func skipSpace(r *bufio.Reader) error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return r.UnreadByte()
+	}
+}
@@ -0,0 +1,55 @@
+package ncclient
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Reconnect tears down whatever is left of the session and establishes a
+// new one: it reconnects the transport and exchanges hellos again. Use it
+// after an operation fails with ErrSessionUnusable, for example because the
+// device rebooted.
+func (n *Ncclient) Reconnect() error {
+	return n.ReconnectContext(context.Background())
+}
+
+// ReconnectContext is like Reconnect but gives up when ctx is done; see
+// ConnectContext.
+func (n *Ncclient) ReconnectContext(ctx context.Context) error {
+	n.mu.Lock()
+	n.closeTransport()
+	n.mu.Unlock()
+	return n.ConnectContext(ctx)
+}
+
+// ReconnectWithBackoff calls Reconnect up to attempts times, at least once,
+// until it succeeds, sleeping backoff after the first failure and doubling
+// the sleep after each one after that. It returns the last error if every
+// attempt fails. Failures that trying again cannot fix, those matching
+// ErrAuth or ErrHostKey, are returned at once.
+func (n *Ncclient) ReconnectWithBackoff(attempts int, backoff time.Duration) error {
+	return n.ReconnectWithBackoffContext(context.Background(), attempts, backoff)
+}
+
+// ReconnectWithBackoffContext is like ReconnectWithBackoff but gives up
+// when ctx is done, including while sleeping between attempts.
+func (n *Ncclient) ReconnectWithBackoffContext(ctx context.Context, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		err := n.ReconnectContext(ctx)
+		if err == nil || attempt == attempts || errors.Is(err, ErrAuth) || errors.Is(err, ErrHostKey) {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
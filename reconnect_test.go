@@ -0,0 +1,70 @@
+package ncclient
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" })
+	first := client.SessionID()
+
+	client.mu.Lock()
+	client.transport.Close()
+	client.mu.Unlock()
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Fatalf("got %v, want %v", err, ErrSessionUnusable)
+	}
+
+	if err := client.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if client.SessionID() == first {
+		t.Errorf("session-id %d was not renewed", first)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("Get after Reconnect: %v", err)
+	}
+}
+
+func TestReconnectWithBackoffHostKey(t *testing.T) {
+	reject := func(string, net.Addr, ssh.PublicKey) error { return errors.New("unknown host key") }
+	client := newFakeClient(t, func(string) string { return "<ok/>" }, WithHostKeyCallback(reject))
+
+	start := time.Now()
+	err := client.ReconnectWithBackoff(5, time.Hour)
+	if !errors.Is(err, ErrHostKey) {
+		t.Fatalf("got %v, want %v", err, ErrHostKey)
+	}
+	if elapsed := time.Since(start); elapsed > time.Minute {
+		t.Errorf("a host key failure was retried for %v", elapsed)
+	}
+}
+
+func TestReconnectWithBackoffContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	// nothing listens on the port any more, so every dial fails
+	listener.Close()
+	client, err := NewClient("127.0.0.1", WithPort(port), WithHostKeyCallback(InsecureIgnoreHostKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.ReconnectWithBackoffContext(ctx, 5, time.Hour); err == nil {
+		t.Fatal("ReconnectWithBackoffContext succeeded with nothing to connect to")
+	}
+	if elapsed := time.Since(start); elapsed > time.Minute {
+		t.Errorf("ReconnectWithBackoffContext slept for %v after ctx was done", elapsed)
+	}
+}
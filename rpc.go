@@ -0,0 +1,307 @@
+package ncclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrMessageIDMismatch is returned when a reply carries neither the
+// message-id of the rpc it answers nor that of an earlier rpc, whose
+// replies are discarded. The session is unusable afterwards.
+var ErrMessageIDMismatch = errors.New("rpc-reply message-id does not match request")
+
+// RPCError is a single <rpc-error> from an <rpc-reply> (RFC 6241 section 4.3).
+type RPCError struct {
+	Type     string       `xml:"error-type"`
+	Tag      string       `xml:"error-tag"`
+	Severity string       `xml:"error-severity"`
+	Message  string       `xml:"error-message"`
+	Path     string       `xml:"error-path"`
+	Info     RPCErrorInfo `xml:"error-info"`
+}
+
+// RPCErrorInfo holds the protocol or data-model specific <error-info>
+// content of an rpc-error as raw XML.
+type RPCErrorInfo struct {
+	InnerXML string `xml:",innerxml"`
+}
+
+// SessionID returns the session-id in the error-info, which names the
+// session holding a lock for a lock-denied error. ok is false if there is
+// none. A session-id of 0 means the lock is held by something other than a
+// NETCONF session.
+func (e *RPCError) SessionID() (id uint64, ok bool) {
+	var info struct {
+		SessionID *string `xml:"session-id"`
+	}
+	if err := xml.Unmarshal([]byte("<error-info>"+e.Info.InnerXML+"</error-info>"), &info); err != nil || info.SessionID == nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(*info.SessionID), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// lockContention reports whether err is an rpc-error saying that a lock is
+// held by another session.
+func lockContention(err error) bool {
+	var rpcError *RPCError
+	if !errors.As(err, &rpcError) {
+		return false
+	}
+	return rpcError.Tag == "lock-denied" || rpcError.Tag == "in-use"
+}
+
+func (e *RPCError) Error() string {
+	message := strings.TrimSpace(e.Message)
+	if message == "" {
+		message = e.Tag
+	}
+	return fmt.Sprintf("netconf rpc-error: %s/%s: %s", e.Type, e.Tag, message)
+}
+
+// RPCReply is a parsed <rpc-reply>. MessageID echoes the message-id of the
+// <rpc> it answers and InnerXML holds everything inside the <rpc-reply>,
+// such as the <data> of a get. RawReply keeps the whole reply exactly as
+// received, for archiving or decoding it differently.
+type RPCReply struct {
+	XMLName   xml.Name   `xml:"rpc-reply"`
+	MessageID string     `xml:"message-id,attr"`
+	Errors    []RPCError `xml:"rpc-error"`
+	Ok        *struct{}  `xml:"ok"`
+	InnerXML  []byte     `xml:",innerxml"`
+	RawReply  []byte     `xml:"-"`
+	// Operation names the operation the reply answers, such as get or
+	// get-config, for replies to the client's own operations. It is empty
+	// for replies parsed with ParseRPCReply.
+	Operation string `xml:"-"`
+
+	// stripDeclarations leaves XML declarations out of Data
+	stripDeclarations bool
+}
+
+// ParseRPCReply unmarshals an <rpc-reply> and collects its rpc-errors. The
+// reply is returned even when it carries errors; if any has severity
+// "error" it is also returned as the error, so warnings alone do not fail
+// the call.
+func ParseRPCReply(r io.Reader) (*RPCReply, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reply := &RPCReply{RawReply: data}
+	if err := xml.Unmarshal(data, reply); err != nil {
+		return nil, err
+	}
+	for i := range reply.Errors {
+		rpcError := &reply.Errors[i]
+		rpcError.Type = strings.TrimSpace(rpcError.Type)
+		rpcError.Tag = strings.TrimSpace(rpcError.Tag)
+		rpcError.Severity = strings.TrimSpace(rpcError.Severity)
+		rpcError.Path = strings.TrimSpace(rpcError.Path)
+	}
+	for i := range reply.Errors {
+		if reply.Errors[i].Severity == "error" {
+			return reply, &reply.Errors[i]
+		}
+	}
+	return reply, nil
+}
+
+// Data returns the content of the reply's <data> element, such as the
+// configuration returned by a get-config, without the <rpc-reply> and
+// <data> wrappers, as raw XML. Namespace declarations made on <data> or
+// <rpc-reply> are not carried over, and XML declarations within the data
+// are left out if the client was created WithStripDataDeclarations. It
+// returns nil if the reply has no data.
+func (r *RPCReply) Data() []byte {
+	decoder := xml.NewDecoder(bytes.NewReader(r.InnerXML))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 && t.Name.Local == "data" {
+				var data struct {
+					InnerXML []byte `xml:",innerxml"`
+				}
+				if err := decoder.DecodeElement(&data, &t); err != nil {
+					return nil
+				}
+				if r.stripDeclarations {
+					return stripDeclarations(data.InnerXML)
+				}
+				return data.InnerXML
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// ConfigData returns the data of the reply to a get-config, as Data does.
+// It fails for the reply to any other operation, notably a get, whose data
+// holds state such as counters alongside the configuration, so it cannot
+// be mistaken for configuration that can be written back.
+func (r *RPCReply) ConfigData() ([]byte, error) {
+	return r.operationData("get-config")
+}
+
+// StateData returns the data of the reply to a get, state and
+// configuration together, as Data does. It fails for the reply to any
+// other operation.
+func (r *RPCReply) StateData() ([]byte, error) {
+	return r.operationData("get")
+}
+
+// operationData returns Data if the reply answers operation.
+func (r *RPCReply) operationData(operation string) ([]byte, error) {
+	if r.Operation != operation {
+		answers := r.Operation
+		if answers == "" {
+			answers = "an unknown operation"
+		}
+		return nil, fmt.Errorf("reply is to %s, not %s", answers, operation)
+	}
+	return r.Data(), nil
+}
+
+// stripDeclarations returns data without the XML declarations at its top
+// level, along with the whitespace following each. data is returned as it
+// is if it is not well-formed.
+func stripDeclarations(data []byte) []byte {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var out []byte
+	depth := 0
+	kept := 0
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return append(out, data[kept:]...)
+		}
+		if err != nil {
+			return data
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.ProcInst:
+			if depth == 0 && t.Target == "xml" {
+				out = append(out, data[kept:start]...)
+				kept = int(decoder.InputOffset())
+				for kept < len(data) && strings.IndexByte(" \t\r\n", data[kept]) >= 0 {
+					kept++
+				}
+			}
+		}
+	}
+}
+
+// wellFormed returns why data is not a well-formed XML document with a
+// single root element, nil if it is.
+func wellFormed(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	roots := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if roots == 0 {
+				return errors.New("no root element")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+				if roots > 1 {
+					return fmt.Errorf("element <%s> after the root element", t.Name.Local)
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return errors.New("text outside the root element")
+			}
+		}
+	}
+}
+
+// rootElement returns the start element of the root of an XML document
+// without decoding the rest of it.
+func rootElement(data []byte) (xml.StartElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// replyMessageID returns the message-id attribute of the root element of a
+// reply.
+func replyMessageID(data []byte) (string, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return "", err
+	}
+	return attrValue(root.Attr, "message-id"), nil
+}
+
+// attrValue returns the value of the attribute with the given local name.
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Do marshals op with encoding/xml as the body of an rpc, sends it and
+// parses the reply. It lets callers define operations the client has no
+// method for as structs:
+//
+//	type getSchema struct {
+//		XMLName    xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring get-schema"`
+//		Identifier string   `xml:"identifier"`
+//	}
+//
+//	reply, err := client.Do(getSchema{Identifier: "ietf-interfaces"})
+func (n *Ncclient) Do(op interface{}) (*RPCReply, error) {
+	return n.DoContext(context.Background(), op)
+}
+
+// DoContext is like Do but gives up when ctx is done.
+func (n *Ncclient) DoContext(ctx context.Context, op interface{}) (*RPCReply, error) {
+	body, err := xml.Marshal(op)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rpc: %w", err)
+	}
+	return n.rpc(ctx, string(body))
+}
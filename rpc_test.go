@@ -0,0 +1,164 @@
+package ncclient
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRPCReply(t *testing.T) {
+	reply, err := ParseRPCReply(strings.NewReader(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="7"><rpc-error><error-type>application</error-type><error-tag> invalid-value </error-tag><error-severity>error</error-severity><error-path>/interfaces/interface[name='eth0']/mtu</error-path><error-message>MTU out of range</error-message></rpc-error></rpc-reply>`))
+	var rpcError *RPCError
+	if !errors.As(err, &rpcError) {
+		t.Fatalf("got %v, want an *RPCError", err)
+	}
+	if reply == nil || reply.MessageID != "7" {
+		t.Fatalf("reply = %+v, want message-id 7", reply)
+	}
+	if rpcError.Type != "application" || rpcError.Tag != "invalid-value" || rpcError.Severity != "error" || rpcError.Path != "/interfaces/interface[name='eth0']/mtu" {
+		t.Errorf("rpc-error = %+v", rpcError)
+	}
+	if got, want := err.Error(), "netconf rpc-error: application/invalid-value: MTU out of range"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRPCReplyOk(t *testing.T) {
+	reply, err := ParseRPCReply(strings.NewReader(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Ok == nil || len(reply.Errors) != 0 {
+		t.Errorf("reply = %+v, want <ok/>", reply)
+	}
+}
+
+func TestParseRPCReplyWarning(t *testing.T) {
+	// only errors fail the rpc
+	reply, err := ParseRPCReply(strings.NewReader(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error><ok/></rpc-reply>`))
+	if err != nil {
+		t.Fatalf("a warning failed the rpc: %v", err)
+	}
+	if len(reply.Errors) != 1 {
+		t.Errorf("reply.Errors = %+v, want the warning", reply.Errors)
+	}
+}
+
+func TestRPCReplyData(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{`<rpc-reply message-id="1"><data><a><b>1</b></a><c/></data></rpc-reply>`, `<a><b>1</b></a><c/>`},
+		{`<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><nc:data><a/></nc:data></nc:rpc-reply>`, `<a/>`},
+		// only the <data> directly inside the reply counts
+		{`<rpc-reply message-id="1"><x><data>no</data></x><data>yes</data></rpc-reply>`, `yes`},
+		{`<rpc-reply message-id="1"><ok/></rpc-reply>`, ``},
+	}
+	for _, test := range tests {
+		reply, err := ParseRPCReply(strings.NewReader(test.reply))
+		if err != nil {
+			t.Errorf("ParseRPCReply(%q): %v", test.reply, err)
+			continue
+		}
+		if got := string(reply.Data()); got != test.want {
+			t.Errorf("Data() of %s = %q, want %q", test.reply, got, test.want)
+		}
+	}
+}
+
+func TestStripDeclarations(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`<config/>`, `<config/>`},
+		{`<?xml version="1.0"?><config/>`, `<config/>`},
+		{"\n<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n  <config/>", "\n<config/>"},
+		{`<?xml version="1.0"?><a/><?xml version="1.0"?><b/>`, `<a/><b/>`},
+		// only declarations at the top level are removed, and other
+		// processing instructions are kept
+		{`<a><?xml-stylesheet href="s"?></a><?other x?>`, `<a><?xml-stylesheet href="s"?></a><?other x?>`},
+		// data that is not well-formed is returned as it is
+		{`<?xml version="1.0"?><a b></a>`, `<?xml version="1.0"?><a b></a>`},
+	}
+	for _, test := range tests {
+		if got := string(stripDeclarations([]byte(test.input))); got != test.want {
+			t.Errorf("stripDeclarations(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestStripDataDeclarations(t *testing.T) {
+	const data = `<?xml version="1.0" encoding="UTF-8"?><config/>`
+	for _, strip := range []bool{false, true} {
+		var opts []Option
+		want := data
+		if strip {
+			opts = append(opts, WithStripDataDeclarations())
+			want = `<config/>`
+		}
+		client := connectPipe(t, func(s *pipeServer) {
+			s.reply("<data>" + data + "</data>")
+		}, opts...)
+		reply, err := client.GetConfig("running", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(reply.Data()); got != want {
+			t.Errorf("Data() with stripping %v = %q, want %q", strip, got, want)
+		}
+		if !bytes.Contains(reply.RawReply, []byte(data)) {
+			t.Errorf("RawReply %q lost the declaration", reply.RawReply)
+		}
+	}
+}
+
+func TestFakeServerConfigAndStateData(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<data><a/></data>" })
+
+	config, err := client.GetConfig("running", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := config.ConfigData(); err != nil || string(data) != "<a/>" {
+		t.Errorf("ConfigData() of a get-config reply = %q, %v", data, err)
+	}
+	if _, err := config.StateData(); err == nil {
+		t.Error("StateData() of a get-config reply succeeded")
+	}
+
+	state, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := state.StateData(); err != nil || string(data) != "<a/>" {
+		t.Errorf("StateData() of a get reply = %q, %v", data, err)
+	}
+	if _, err := state.ConfigData(); err == nil {
+		t.Error("ConfigData() of a get reply succeeded")
+	}
+
+	// a reply parsed on its own answers no known operation
+	parsed, err := ParseRPCReply(strings.NewReader(`<rpc-reply message-id="1"><data/></rpc-reply>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsed.ConfigData(); err == nil {
+		t.Error("ConfigData() of a reply to an unknown operation succeeded")
+	}
+}
+
+func TestWellFormed(t *testing.T) {
+	for _, data := range []string{`<a/>`, "<?xml version=\"1.0\"?>\n<a><!-- c --></a>\n"} {
+		if err := wellFormed([]byte(data)); err != nil {
+			t.Errorf("wellFormed(%q): %v", data, err)
+		}
+	}
+	for _, data := range []string{``, `<a>`, `<a></b>`, `<a/><b/>`, `<a/>text`} {
+		if wellFormed([]byte(data)) == nil {
+			t.Errorf("wellFormed(%q) succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ncclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// GetSchema retrieves a schema, such as a YANG module, from the server
+// (RFC 6022). identifier names the schema; version and format, for example
+// "yang" or "yin", are left out when empty so the server defaults apply.
+// Use SchemaText to get the schema from the reply.
+func (n *Ncclient) GetSchema(identifier string, version string, format string) (*RPCReply, error) {
+	return n.GetSchemaContext(context.Background(), identifier, version, format)
+}
+
+// GetSchemaContext is like GetSchema but gives up when ctx is done.
+func (n *Ncclient) GetSchemaContext(ctx context.Context, identifier string, version string, format string) (*RPCReply, error) {
+	if err := n.requireCapability(CAPABILITY_MONITORING); err != nil {
+		return nil, err
+	}
+	if identifier == "" {
+		return nil, fmt.Errorf("get-schema requires an identifier")
+	}
+
+	rpc := fmt.Sprintf(`<get-schema xmlns="%s"><identifier>%s</identifier>`, CAPABILITY_MONITORING, escapeText(identifier))
+	if version != "" {
+		rpc += fmt.Sprintf("<version>%s</version>", escapeText(version))
+	}
+	if format != "" {
+		rpc += fmt.Sprintf("<format>%s</format>", escapeText(format))
+	}
+	rpc += "</get-schema>"
+	return n.rpc(ctx, rpc)
+}
+
+// SchemaText returns the schema held in the <data> of a get-schema reply,
+// with XML escaping undone.
+func SchemaText(reply *RPCReply) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(reply.InnerXML))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", fmt.Errorf("get-schema reply has no data")
+		}
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "data" {
+			var text string
+			if err := decoder.DecodeElement(&text, &start); err != nil {
+				return "", err
+			}
+			return text, nil
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package ncclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// maxRootElement bounds how much of a message is held back while looking for
+// its root element to decide whether it is the reply being streamed.
+const maxRootElement = 64 * 1024
+
+// replyStream is an rpc-reply being copied to the caller as it is decoded.
+type replyStream struct {
+	pipe      *io.PipeWriter
+	messageID string
+	// done is closed once the whole reply has been decoded
+	done chan struct{}
+}
+
+// finish ends the stream, with err if the reply could not be read in full.
+func (s *replyStream) finish(err error) {
+	s.pipe.CloseWithError(err)
+	close(s.done)
+}
+
+// replySink receives a message decoded while a stream is waiting. It holds
+// back the start of the message until the root element is known, then
+// copies an rpc-reply to the stream and buffers anything else, such as a
+// notification, for the usual routing.
+type replySink struct {
+	stream    *replyStream
+	head      bytes.Buffer
+	out       io.Writer
+	streaming bool
+}
+
+func (s *replySink) Write(p []byte) (int, error) {
+	if s.out == nil {
+		s.head.Write(p)
+		root, err := rootElement(s.head.Bytes())
+		if err != nil && s.head.Len() < maxRootElement {
+			return len(p), nil
+		}
+		if err == nil && root.Name.Local == "rpc-reply" {
+			s.streaming = true
+			s.out = &discardOnError{w: s.stream.pipe}
+			if replyID := attrValue(root.Attr, "message-id"); replyID != s.stream.messageID {
+				s.stream.pipe.CloseWithError(fmt.Errorf("%w: sent %s, received %q", ErrMessageIDMismatch, s.stream.messageID, replyID))
+			}
+		} else {
+			s.out = new(bytes.Buffer)
+		}
+		s.out.Write(s.head.Bytes())
+		return len(p), nil
+	}
+	s.out.Write(p)
+	return len(p), nil
+}
+
+// message returns a message that was not streamed.
+func (s *replySink) message() *bytes.Buffer {
+	if buf, ok := s.out.(*bytes.Buffer); ok {
+		return buf
+	}
+	return &s.head
+}
+
+// discardOnError writes to w until a write fails, for example because the
+// caller closed the stream early, and silently drops everything after. The
+// rest of the message must still be decoded to keep the framing in step.
+type discardOnError struct {
+	w   io.Writer
+	err error
+}
+
+func (d *discardOnError) Write(p []byte) (int, error) {
+	if d.err == nil {
+		_, d.err = d.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// WriteRPCStream is like WriteRPC but returns the reply as it arrives rather
+// than buffering all of it first, so very large replies can be piped into an
+// xml.Decoder or a file without holding them in memory. The stream must be
+// read to the end or closed; closing it early discards the rest of the
+// reply. rpc-errors are not parsed, they are part of the streamed document.
+//
+// Other operations wait until the stream has been read to the end or
+// closed, so a goroutine holding an unfinished stream must not start
+// another operation on the same client.
+func (n *Ncclient) WriteRPCStream(line string) (io.ReadCloser, error) {
+	return n.WriteRPCStreamContext(context.Background(), line)
+}
+
+// WriteRPCStreamContext is like WriteRPCStream but gives up when ctx is
+// done. The client timeout, or the deadline of ctx, covers the whole
+// transfer, so large replies usually want a context with a generous
+// deadline. Giving up part way through makes the session unusable.
+func (n *Ncclient) WriteRPCStreamContext(ctx context.Context, line string) (io.ReadCloser, error) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n.transport == nil {
+		n.mu.Unlock()
+		return nil, ErrNotConnected
+	}
+	if err := n.broken; err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	if n.serverHello == nil {
+		n.mu.Unlock()
+		return nil, ErrNoHello
+	}
+	if n.reader.stopped() {
+		err := n.readFailed(ctx, n.reader.err)
+		n.mu.Unlock()
+		return nil, err
+	}
+
+	messageID, rpc := n.wrapRPC([]byte(line))
+
+	timeoutCtx, cancel := n.operationContext(ctx)
+	closing := n.closingChannel()
+
+	reader, writer := io.Pipe()
+	stream := &replyStream{pipe: writer, messageID: messageID, done: make(chan struct{})}
+	n.reader.expectStream(stream)
+	if err := n.send(rpc...); err != nil {
+		cancel()
+		n.reader.takeStream()
+		err = n.readFailed(ctx, err)
+		n.mu.Unlock()
+		return nil, err
+	}
+	if n.reader.synchronous {
+		go n.reader.readStream(n)
+	}
+
+	transport := n.transport
+	// the session stays locked until the whole reply has been decoded
+	go func() {
+		defer n.mu.Unlock()
+		defer cancel()
+		select {
+		case <-stream.done:
+		case <-timeoutCtx.Done():
+			err := ctx.Err()
+			if err == nil {
+				err = ErrTimeout
+			}
+			// the session reader sees the transport close and reports the
+			// session unusable to the next operation
+			writer.CloseWithError(err)
+			transport.Close()
+		case <-closing:
+			writer.CloseWithError(ErrClosed)
+			transport.Close()
+		}
+	}()
+	return reader, nil
+}
+
+// GetConfigStream is like GetConfig but streams the reply; see
+// WriteRPCStream.
+func (n *Ncclient) GetConfigStream(source string, filter string) (io.ReadCloser, error) {
+	return n.GetConfigStreamContext(context.Background(), source, filter)
+}
+
+// GetConfigStreamContext is like GetConfigStream but gives up when ctx is
+// done.
+func (n *Ncclient) GetConfigStreamContext(ctx context.Context, source string, filter string) (io.ReadCloser, error) {
+	datastore, err := datastoreElement(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.requireDatastore(source, false); err != nil {
+		return nil, err
+	}
+	filterElement, err := SubtreeFilter(filter).orDefault(n).render(n)
+	if err != nil {
+		return nil, err
+	}
+	return n.WriteRPCStreamContext(ctx, fmt.Sprintf("<get-config><source>%s</source>%s</get-config>", datastore, filterElement))
+}
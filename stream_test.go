@@ -0,0 +1,37 @@
+package ncclient
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetConfigStreamCapabilities(t *testing.T) {
+	n := &Ncclient{mu: new(sync.Mutex), capabilities: []string{NETCONF_BASE_10}}
+	if _, err := n.GetConfigStream("candidate", ""); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedCapability)
+	}
+}
+
+func TestFakeServerGetConfigStream(t *testing.T) {
+	client := connectFake(t, func(string) string {
+		return `<data><system xmlns="urn:x"/></data>`
+	})
+	stream, err := client.GetConfigStream("candidate", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if !strings.Contains(string(data), `<system xmlns="urn:x"/>`) {
+		t.Errorf("stream = %s, want the reply's data", data)
+	}
+	if _, err := client.Get(""); err != nil {
+		t.Errorf("Get after the stream: %v", err)
+	}
+}
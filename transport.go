@@ -0,0 +1,353 @@
+package ncclient
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NETCONF_TLS_PORT is the IANA assigned port for NETCONF over TLS (RFC 7589).
+const NETCONF_TLS_PORT int = 6513
+
+// NETCONF_XML_MODE_COMMAND starts NETCONF on devices without a netconf
+// subsystem, such as older JunOS releases.
+const NETCONF_XML_MODE_COMMAND string = "xml-mode netconf need-trailer"
+
+// Transport carries NETCONF messages between client and server. Framing is
+// done by the client, so a Transport only moves bytes. A Transport that
+// also has a SetReadDeadline method, like a net.Conn, is given a read
+// deadline for each operation so a timed out read stops at once.
+type Transport interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+// readDeadliner is implemented by transports, such as TLS connections, on
+// which a blocked read can be given a deadline.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// setReadDeadline sets the transport's read deadline, the zero time for
+// none, and reports whether the transport supports one.
+func (n *Ncclient) setReadDeadline(deadline time.Time) bool {
+	conn, ok := n.transport.(readDeadliner)
+	return ok && conn.SetReadDeadline(deadline) == nil
+}
+
+// sshTransport runs NETCONF over the netconf subsystem of an SSH session
+// (RFC 6242).
+type sshTransport struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+
+	// done is closed when the transport is closed, stopping keepalives
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (t *sshTransport) Read(p []byte) (int, error) {
+	return t.stdout.Read(p)
+}
+
+func (t *sshTransport) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *sshTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.session.Close()
+		err = t.client.Close()
+	})
+	return err
+}
+
+// SSHClient returns the SSH connection the session runs over, or nil when
+// the client is not connected or uses TLS. It is meant for advanced uses
+// such as opening another channel on the same connection, and is not
+// covered by any compatibility promise. Closing the connection or
+// interfering with the NETCONF session's channel breaks the client.
+func (n *Ncclient) SSHClient() *ssh.Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t, ok := n.dialedTransport().(*sshTransport); ok {
+		return t.client
+	}
+	return nil
+}
+
+// RemoteAddr returns the address of the server the session is connected
+// to, which tells which backend answered when the hostname resolves to
+// several, or nil when the client is not connected or uses a transport
+// with no address. Through a jump host it is the address the jump host
+// connected to.
+func (n *Ncclient) RemoteAddr() net.Addr {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t, ok := n.dialedTransport().(interface{ RemoteAddr() net.Addr }); ok {
+		return t.RemoteAddr()
+	}
+	return nil
+}
+
+func (t *sshTransport) RemoteAddr() net.Addr {
+	return t.client.RemoteAddr()
+}
+
+// dialedTransport returns the transport Connect dialed, without the
+// wrapper WithTrafficCapture adds. The caller must hold n.mu.
+func (n *Ncclient) dialedTransport() Transport {
+	if capture, ok := n.transport.(*captureTransport); ok {
+		return capture.Transport
+	}
+	return n.transport
+}
+
+// keepalive sends an OpenSSH keepalive request every interval until the
+// transport is closed. Any reply, even a refusal, shows the server is
+// alive. After maxMissed keepalives in a row go unanswered, or as soon as
+// sending one fails, the transport is closed so the session reader stops
+// and operations fail with ErrSessionUnusable instead of timing out.
+func (t *sshTransport) keepalive(interval time.Duration, maxMissed int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := t.client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		select {
+		case <-t.done:
+			return
+		case err := <-replied:
+			if err != nil {
+				t.Close()
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed >= maxMissed {
+				t.Close()
+				return
+			}
+		}
+	}
+}
+
+// dialAddress returns the host:port to connect to. IPv6 literals are
+// bracketed, so "::1" becomes "[::1]:830".
+func (n *Ncclient) dialAddress() string {
+	return net.JoinHostPort(n.dialHost(), strconv.Itoa(n.dialPort()))
+}
+
+// dialHost returns the hostname without the brackets an IPv6 literal may
+// have been given with, such as "[::1]".
+func (n *Ncclient) dialHost() string {
+	host := n.hostname
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// dialConn opens a TCP connection to the server, with the dialer or from
+// the jump host if one is configured, giving up when ctx is done or the
+// connect timeout passes. A connection given with WithConn is returned
+// instead, once.
+func (n *Ncclient) dialConn(ctx context.Context) (net.Conn, error) {
+	if n.conn != nil {
+		if n.connUsed {
+			return nil, errors.New("the connection given with WithConn has already been used")
+		}
+		n.connUsed = true
+		return n.conn, nil
+	}
+	if n.dialer != nil {
+		if n.jumpHost != nil {
+			return nil, errors.New("WithDialer cannot be combined with WithJumpHost")
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, n.dialTimeout())
+		defer cancel()
+		return n.dialer(dialCtx, "tcp", n.dialAddress())
+	}
+	if n.jumpHost == nil {
+		dialer := net.Dialer{Timeout: n.dialTimeout()}
+		return dialer.DialContext(ctx, "tcp", n.dialAddress())
+	}
+
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, n.dialTimeout())
+	defer cancel()
+	// the jump host dial cannot be interrupted, so it is left to finish on
+	// its own and its connection closed
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := n.jumpHost.Dial("tcp", n.dialAddress())
+		result <- dialed{conn, err}
+	}()
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return nil, fmt.Errorf("jump host: %w", r.err)
+		}
+		return r.conn, nil
+	case <-dialCtx.Done():
+		go func() {
+			if r := <-result; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("jump host: %w", dialCtx.Err())
+	}
+}
+
+// dialTimeout returns how long to wait for a connection to be established.
+func (n *Ncclient) dialTimeout() time.Duration {
+	if n.connectTimeout != 0 {
+		return n.connectTimeout
+	}
+	return n.timeout
+}
+
+// replyTimeout returns how long to wait for the reply to an rpc.
+func (n *Ncclient) replyTimeout() time.Duration {
+	if n.rpcTimeout != 0 {
+		return n.rpcTimeout
+	}
+	return n.timeout
+}
+
+// dialPort returns the port to connect to, the IANA port of the transport
+// in use unless one was configured.
+func (n *Ncclient) dialPort() int {
+	if n.port != 0 {
+		return n.port
+	}
+	if n.tlsConfig != nil {
+		return NETCONF_TLS_PORT
+	}
+	return NETCONF_PORT
+}
+
+// dialSSHTransport opens an SSH session and starts the netconf subsystem,
+// or the configured command instead.
+func (n *Ncclient) dialSSHTransport(ctx context.Context) (Transport, error) {
+	sshClient, sshSession, sessionStdin, sessionStdout, err := n.dialSSH(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// closing the client aborts the requests below if ctx is done first
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	if n.command != "" {
+		if err := sshSession.Start(n.command); err != nil {
+			sshSession.Close()
+			sshClient.Close()
+			return nil, &connectError{ErrSubsystem, fmt.Errorf("failed to start %q: %w", n.command, err)}
+		}
+	} else if err := sshSession.RequestSubsystem("netconf"); err != nil {
+		sshSession.Close()
+		if !n.xmlModeFallback {
+			sshClient.Close()
+			return nil, &connectError{ErrSubsystem, fmt.Errorf("failed to make subsystem request: %w", err)}
+		}
+
+		// the failed request used up the session, so start over in a new one
+		sshSession, sessionStdin, sessionStdout, err = openSession(sshClient)
+		if err != nil {
+			sshClient.Close()
+			return nil, err
+		}
+		if err := sshSession.Start(NETCONF_XML_MODE_COMMAND); err != nil {
+			sshSession.Close()
+			sshClient.Close()
+			return nil, &connectError{ErrSubsystem, fmt.Errorf("failed to make subsystem request and to start %q: %w", NETCONF_XML_MODE_COMMAND, err)}
+		}
+	}
+	if ctx.Err() != nil {
+		sshSession.Close()
+		sshClient.Close()
+		return nil, fmt.Errorf("failed to start netconf: %w", ctx.Err())
+	}
+	transport := &sshTransport{
+		client:  sshClient,
+		session: sshSession,
+		stdin:   sessionStdin,
+		stdout:  sessionStdout,
+		done:    make(chan struct{}),
+	}
+	if n.keepaliveInterval > 0 {
+		go transport.keepalive(n.keepaliveInterval, n.keepaliveMaxMissed)
+	}
+	return transport, nil
+}
+
+// dialTLS connects with NETCONF over TLS (RFC 7589). The client
+// authenticates with the certificates in its tls.Config; the server derives
+// the NETCONF username from the certificate.
+func (n *Ncclient) dialTLS(ctx context.Context) (Transport, error) {
+	config := n.tlsConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = n.dialHost()
+	}
+
+	rawConn, err := n.dialConn(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to dial %s: %w", n.hostname, ctx.Err())
+		}
+		return nil, &connectError{ErrDial, fmt.Errorf("failed to dial %s: %w", n.hostname, err)}
+	}
+	conn := tls.Client(rawConn, config)
+	conn.SetDeadline(time.Now().Add(n.dialTimeout()))
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		err = fmt.Errorf("failed to dial %s: %w", n.hostname, err)
+		if ctx.Err() != nil {
+			err = fmt.Errorf("failed to dial %s: %w", n.hostname, ctx.Err())
+		} else if isCertificateError(err) {
+			err = &connectError{ErrHostKey, err}
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// isCertificateError reports whether err is a failure to verify the
+// server's certificate.
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid)
+}
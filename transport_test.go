@@ -0,0 +1,133 @@
+package ncclient
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeepaliveAnswered(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" }, WithKeepalive(5*time.Millisecond, 1))
+	// the server refuses keepalive requests, which still shows it is alive
+	time.Sleep(50 * time.Millisecond)
+	if _, err := client.Get(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeepaliveTeardown(t *testing.T) {
+	client := connectFake(t, func(string) string { return "<ok/>" }, WithKeepalive(time.Hour, 1))
+
+	// tear the transport down as keepalive does after missed replies
+	client.mu.Lock()
+	transport := client.dialedTransport().(*sshTransport)
+	client.mu.Unlock()
+	transport.Close()
+
+	if _, err := client.Get(""); !errors.Is(err, ErrSessionUnusable) {
+		t.Fatalf("got %v, want %v", err, ErrSessionUnusable)
+	}
+	if client.Connected() {
+		t.Error("Connected() after the transport was torn down")
+	}
+}
+
+// tlsServer starts a NETCONF over TLS server on a loopback port that
+// answers every rpc with content, and returns its port and a pool
+// trusting its certificate.
+func tlsServer(t *testing.T, content string) (int, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "netconf test server"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				s := &pipeServer{conn: conn, r: bufio.NewReader(conn)}
+				if err := s.write(fakeServerHello(1)); err != nil {
+					return
+				}
+				if _, err := s.read(); err != nil {
+					return
+				}
+				for {
+					if err := s.reply(content); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, pool
+}
+
+func TestTLS(t *testing.T) {
+	port, pool := tlsServer(t, "<data><a/></data>")
+	client, err := NewClient("127.0.0.1", WithPort(port), WithTLS(&tls.Config{RootCAs: pool}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(reply.Data()); got != "<a/>" {
+		t.Errorf("Data() = %q, want <a/>", got)
+	}
+}
+
+func TestTLSUntrustedCertificate(t *testing.T) {
+	port, _ := tlsServer(t, "<ok/>")
+	client, err := NewClient("127.0.0.1", WithPort(port), WithTLS(&tls.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Connect(); !errors.Is(err, ErrHostKey) {
+		t.Errorf("got %v, want %v", err, ErrHostKey)
+	}
+}
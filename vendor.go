@@ -0,0 +1,38 @@
+package ncclient
+
+// CAPABILITY_JUNOS is the capability Junos devices advertise for their
+// proprietary rpcs, such as <get-chassis-inventory/>.
+const CAPABILITY_JUNOS string = "http://xml.juniper.net/netconf/junos/1.0"
+
+// withOptions combines opts into a single Option.
+func withOptions(opts ...Option) Option {
+	return func(n *Ncclient) error {
+		for _, opt := range opts {
+			if err := opt(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithJuniperDefaults configures the client for Junos devices. Older
+// releases have no netconf subsystem, so it falls back to xml-mode, and the
+// hello advertises the Junos capability alongside DefaultCapabilities.
+// Options given after it override it.
+func WithJuniperDefaults() Option {
+	return withOptions(
+		WithXMLModeFallback(),
+		WithExtraCapabilities(CAPABILITY_JUNOS),
+	)
+}
+
+// WithCiscoDefaults configures the client for IOS XE, IOS XR and NX-OS
+// devices, enabling keyboard-interactive authentication because TACACS+
+// backed devices commonly accept nothing else. Options given after it
+// override it.
+func WithCiscoDefaults() Option {
+	return withOptions(
+		WithKeyboardInteractive(),
+	)
+}
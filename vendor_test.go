@@ -0,0 +1,30 @@
+package ncclient
+
+import "testing"
+
+func TestVendorDefaults(t *testing.T) {
+	juniper, err := NewClient("r1", WithJuniperDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !juniper.xmlModeFallback || !containsString(juniper.localCapabilities(), CAPABILITY_JUNOS) {
+		t.Error("WithJuniperDefaults did not enable xml-mode and the Junos capability")
+	}
+
+	cisco, err := NewClient("r1", WithCiscoDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cisco.keyboardInteractive {
+		t.Error("WithCiscoDefaults did not enable keyboard-interactive authentication")
+	}
+
+	// options given after a preset override it
+	override, err := NewClient("r1", WithJuniperDefaults(), WithCapabilities(NETCONF_BASE_10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(override.localCapabilities(), CAPABILITY_JUNOS) {
+		t.Error("WithCapabilities after WithJuniperDefaults kept the Junos capability")
+	}
+}